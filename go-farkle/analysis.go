@@ -0,0 +1,216 @@
+package farkle
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Win probability lost by an action below which it is considered
+// optimal, to allow for rounding in quantized databases.
+const mistakeTolerance = 1e-6
+
+// MistakeKind classifies a suboptimal action.
+type MistakeKind int
+
+const (
+	// Held the dice of the optimal action but stopped,
+	// when the optimal action continues rolling.
+	BankedTooEarly MistakeKind = iota
+	// Held the dice of the optimal action but continued rolling,
+	// when the optimal action stops.
+	PushedTooLong
+	// Held different dice than the optimal action.
+	WrongDice
+	numMistakeKinds
+)
+
+var mistakeKindNames = [numMistakeKinds]string{
+	BankedTooEarly: "banked too early",
+	PushedTooLong:  "pushed too long",
+	WrongDice:      "held the wrong dice",
+}
+
+func (k MistakeKind) String() string {
+	if k < 0 || k >= numMistakeKinds {
+		return fmt.Sprintf("MistakeKind(%d)", int(k))
+	}
+	return mistakeKindNames[k]
+}
+
+func classifyMistake(action, best Action) MistakeKind {
+	switch {
+	case action.HeldDiceID != best.HeldDiceID:
+		return WrongDice
+	case best.ContinueRolling:
+		return BankedTooEarly
+	default:
+		return PushedTooLong
+	}
+}
+
+// Mistake is a suboptimal action in a recorded game.
+type Mistake struct {
+	// Index of the game in the analysis, and of the roll in the game.
+	Game, Roll int
+	// Name of the player who made the mistake.
+	Player string
+	// State before rolling, from the player's perspective, and the dice rolled.
+	State      GameState
+	Rolled     Roll
+	Action     Action
+	BestAction Action
+	Kind       MistakeKind
+	// Win probability lost compared with the optimal action.
+	Loss float64
+}
+
+// PlayerStats summarizes the actions of one player.
+type PlayerStats struct {
+	Name string
+	// Number of rolls that were not a farkle, and how many
+	// of them were followed by the optimal action.
+	NumDecisions int
+	NumOptimal   int
+	// Total win probability lost to suboptimal actions.
+	TotalLoss float64
+	// Number of mistakes and win probability lost by kind of mistake.
+	NumMistakes [numMistakeKinds]int
+	KindLoss    [numMistakeKinds]float64
+}
+
+// Percentage of decisions for which the player chose the optimal action.
+func (s *PlayerStats) Accuracy() float64 {
+	if s.NumDecisions == 0 {
+		return 100
+	}
+	return 100 * float64(s.NumOptimal) / float64(s.NumDecisions)
+}
+
+// BlunderAnalysis compares the actions in recorded games with optimal
+// play according to a solution database. Players are identified by their
+// name in the game header, so that a player's mistakes are combined
+// across a batch of games even if they change seats.
+type BlunderAnalysis struct {
+	db DB
+	// Rules the database was solved with, which all games must be played with.
+	rules    *Rules
+	NumGames int
+	// Players in order of first appearance.
+	Players  []*PlayerStats
+	Mistakes []Mistake
+}
+
+// Analyze games with a database solved with the given rules.
+func NewBlunderAnalysis(rules *Rules, db DB) *BlunderAnalysis {
+	return &BlunderAnalysis{db: db, rules: rules}
+}
+
+// Add the actions of a game to the analysis. It is an error if the game
+// was not played with the rules and number of players of the database.
+func (a *BlunderAnalysis) AddGame(game GameRecord) error {
+	tables, err := game.Tables()
+	if err != nil {
+		return err
+	}
+	if !game.Header.Rules.Equal(a.rules) {
+		return fmt.Errorf("game was played with rules {%v}, but database was solved with {%v}",
+			game.Header.Rules, a.rules)
+	}
+	if game.Header.NumPlayers != a.db.NumPlayers() {
+		return fmt.Errorf("game was played with %d players, but database is for %d",
+			game.Header.NumPlayers, a.db.NumPlayers())
+	}
+
+	rules := a.rules
+	gameIdx := a.NumGames
+	a.NumGames++
+	players := make([]*PlayerStats, game.Header.NumPlayers)
+	for seat := range players {
+		name := fmt.Sprintf("seat %d", seat)
+		if seat < len(game.Header.Players) {
+			name = game.Header.Players[seat]
+		}
+		players[seat] = a.player(name)
+	}
+
+	for i, rr := range game.Rolls {
+		rollID := GetRollID(rr.Roll)
+		if IsFarkle(rules.Scoring, rr.Roll) {
+			continue
+		}
+
+		state := tables[i].GameState()
+		best, bestWinProb := SelectAction(rules, state, rollID, a.db)
+		action, winProb, _ := evaluateAction(rules, state, rr.Action, a.db)
+		player := players[rr.Seat]
+		player.NumDecisions++
+		loss := bestWinProb[0] - winProb[0]
+		if loss <= mistakeTolerance {
+			player.NumOptimal++
+			continue
+		}
+
+		kind := classifyMistake(action, best)
+		player.TotalLoss += loss
+		player.NumMistakes[kind]++
+		player.KindLoss[kind] += loss
+		a.Mistakes = append(a.Mistakes, Mistake{
+			Game:       gameIdx,
+			Roll:       i,
+			Player:     player.Name,
+			State:      state,
+			Rolled:     rr.Roll,
+			Action:     rr.Action,
+			BestAction: best,
+			Kind:       kind,
+			Loss:       loss,
+		})
+	}
+
+	return nil
+}
+
+func (a *BlunderAnalysis) player(name string) *PlayerStats {
+	for _, p := range a.Players {
+		if p.Name == name {
+			return p
+		}
+	}
+	p := &PlayerStats{Name: name}
+	a.Players = append(a.Players, p)
+	return p
+}
+
+// The n mistakes that lost the most win probability, worst first.
+func (a *BlunderAnalysis) TopMistakes(n int) []Mistake {
+	mistakes := append([]Mistake(nil), a.Mistakes...)
+	sort.SliceStable(mistakes, func(i, j int) bool {
+		return mistakes[i].Loss > mistakes[j].Loss
+	})
+	return mistakes[:min(n, len(mistakes))]
+}
+
+// Write a summary of each player's mistakes, and the worst numMistakes mistakes.
+func (a *BlunderAnalysis) WriteReport(w io.Writer, numMistakes int) {
+	fmt.Fprintf(w, "Analyzed %d game(s)\n\n", a.NumGames)
+	for _, p := range a.Players {
+		fmt.Fprintf(w, "%s: %d decisions, accuracy %.1f%%, lost %.4f pWin\n",
+			p.Name, p.NumDecisions, p.Accuracy(), p.TotalLoss)
+		for kind := MistakeKind(0); kind < numMistakeKinds; kind++ {
+			fmt.Fprintf(w, "...%s: %d mistake(s), lost %.4f pWin\n",
+				kind, p.NumMistakes[kind], p.KindLoss[kind])
+		}
+	}
+
+	top := a.TopMistakes(numMistakes)
+	if len(top) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nBiggest mistakes:\n")
+	for _, m := range top {
+		fmt.Fprintf(w, "Game %d, roll %d, %s in state %s rolled %v:\n",
+			m.Game, m.Roll, m.Player, a.rules.FormatState(m.State), m.Rolled)
+		fmt.Fprintf(w, "...%s: chose %v instead of %v, losing %f pWin\n", m.Kind, m.Action, m.BestAction, m.Loss)
+	}
+}
@@ -0,0 +1,63 @@
+package farkle
+
+import (
+	"strings"
+	"testing"
+)
+
+// Record of a game played with the rules, which must end after a
+// straight by the first player and a farkle by the second.
+func scriptedGameRecord(t *testing.T, rules *Rules) GameRecord {
+	t.Helper()
+	dice := NewScriptedDice(1, 2, 3, 4, 5, 6, 2, 2, 3, 3, 4, 6)
+	_, rolls, err := PlayRecordedGame(rules, thresholdStrategies(rules, 2), dice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return GameRecord{
+		Header: GameRecordHeader{Rules: rules, NumPlayers: 2, Dice: "file:script"},
+		Rolls:  rolls,
+	}
+}
+
+func TestBlunderAnalysisChecksGame(t *testing.T) {
+	otherRules := *shortGameRules
+	otherRules.ScoreToWin = 2000
+	otherRulesRecord := scriptedGameRecord(t, shortGameRules)
+	otherRulesRecord.Header.Rules = &otherRules
+
+	testCases := []struct {
+		name string
+		game GameRecord
+		// Number of players the database is solved for.
+		numPlayers int
+		wantErr    string
+	}{
+		{"same rules", scriptedGameRecord(t, shortGameRules), 2, ""},
+		{"different rules", otherRulesRecord, 2, "rules"},
+		{"different players", scriptedGameRecord(t, shortGameRules), 3, "players"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			analysis := NewBlunderAnalysis(shortGameRules, NewMemDB(shortGameRules, tc.numPlayers))
+			err := analysis.AddGame(tc.game)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if analysis.NumGames != 1 {
+					t.Errorf("analyzed %d games, expected 1", analysis.NumGames)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %v, expected one about %s", err, tc.wantErr)
+			}
+			if analysis.NumGames != 0 {
+				t.Errorf("analyzed %d games, expected none", analysis.NumGames)
+			}
+		})
+	}
+}
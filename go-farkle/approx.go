@@ -0,0 +1,601 @@
+package farkle
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/golang/glog"
+	"golang.org/x/sys/unix"
+)
+
+// Games with more than maxNumPlayers players have too many states
+// to solve exactly, since the score of every opponent is tracked. An
+// approximate solution abstracts the opponents away: the current player
+// only knows their own score, the leader's score (the highest score of any
+// opponent) and, in the final round, how many opponents will play after
+// them. Rather than being solved, the opponents are modeled:
+//
+//   - Between two turns of the current player, every opponent plays a turn
+//     with a fixed heuristic strategy. The leader plays from their score,
+//     and the other opponents from the current player's score at the start
+//     of their turn (or the leader's, if it is lower).
+//   - When an opponent reaches the score to win, the current player is
+//     equally likely to be any number of seats after them.
+//   - In the final round, opponents who play after a player chase their
+//     score with the strategy most likely to beat it, starting from the
+//     same score as the other opponents.
+//   - Ties are ignored, except a tie with the leader in the final round
+//     and a tie at the highest score, which are valued by the tie-break
+//     policy.
+//     The farkle penalty is ignored.
+//
+// With two players, the abstraction is exact except that the opponent
+// plays the fixed strategy rather than optimally.
+
+// Most players in a game that can be solved approximately.
+const maxNumApproxPlayers = 8
+
+// ApproxState is the abstraction of a Table from the current player's
+// perspective that is solved by an approximate solution.
+type ApproxState struct {
+	ScoreThisRound uint16
+	NumDiceToRoll  uint8
+	// Banked score of the current player.
+	Score uint16
+	// Highest banked score of any opponent.
+	LeaderScore uint16
+	// Whether an opponent has reached the score to win, and if so how many
+	// opponents will still play after the current player.
+	FinalRound        bool
+	NumFinalTurnsLeft uint8
+}
+
+// The abstraction of a table at which the game is not over.
+func AbstractTable(rules *Rules, table Table) ApproxState {
+	a := ApproxState{
+		ScoreThisRound: table.ScoreThisRound,
+		NumDiceToRoll:  table.NumDiceToRoll,
+		Score:          table.CurrentPlayerScore(),
+	}
+	for i, score := range table.PlayerScores[1:table.NumPlayers] {
+		if score >= rules.scoreToWin() && !a.FinalRound {
+			// The first opponent to play who has reached the score to win
+			// started the final round, and everyone after them has already
+			// had their last turn.
+			a.FinalRound = true
+			a.NumFinalTurnsLeft = uint8(i)
+		}
+		a.LeaderScore = max(a.LeaderScore, score)
+	}
+	return a
+}
+
+// Number of states within a turn: the score this round and dice to roll.
+// Approximate solutions are only for 1-byte scores, which keeps it small.
+func numApproxTurnStates(rules *Rules) int {
+	return rules.numScores() * MaxNumDice
+}
+
+// A unique ID for this state within an approximate solution. States before
+// the final round are arranged by score and leader score. In the final
+// round, the value of a state only depends on how far the player is behind
+// the leader, so all states with the same deficit share an ID.
+func (a ApproxState) id(rules *Rules) int {
+	idx := int(a.ScoreThisRound)*MaxNumDice + int(a.NumDiceToRoll-1)
+	win := int(rules.scoreToWin())
+	if !a.FinalRound {
+		return (int(a.Score)*win+int(a.LeaderScore))*numApproxTurnStates(rules) + idx
+	}
+	deficit := int(a.LeaderScore) - int(a.Score)
+	maxDeficit := int(rules.maxScore())
+	return (win*win+int(a.NumFinalTurnsLeft)*maxDeficit+deficit-1)*numApproxTurnStates(rules) + idx
+}
+
+func numApproxStates(rules *Rules, numPlayers int) int {
+	win := int(rules.scoreToWin())
+	return (win*win + (numPlayers-1)*int(rules.maxScore())) * numApproxTurnStates(rules)
+}
+
+// Model of the opponents in an approximate solution.
+type approxModel struct {
+	rules      *Rules
+	numPlayers int
+	// Every score is capped at maxScore, as in the game.
+	maxScore int
+	rolls    *turnRolls
+	// Probability of scoring at least the given number of points
+	// in one turn, playing to maximize it.
+	pReach []float64
+	// Cumulative distribution of the points banked in one turn with the
+	// opponent strategy, indexed by [on board][points], counting a farkle
+	// as 0 points.
+	turnCDF [2][]float64
+}
+
+func newApproxModel(rules *Rules, numPlayers int, opponent string) (*approxModel, error) {
+	if numPlayers < 2 || numPlayers > maxNumApproxPlayers {
+		return nil, fmt.Errorf("approximate solutions are for 2-%d players, got %d",
+			maxNumApproxPlayers, numPlayers)
+	}
+	if rules.scoreWidth() != 1 {
+		return nil, fmt.Errorf("approximate solutions are for 1-byte scores, got %d bytes",
+			rules.scoreWidth())
+	}
+	strategy, err := NewHeuristicStrategy(rules, opponent)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &approxModel{
+		rules:      rules,
+		numPlayers: numPlayers,
+		maxScore:   int(rules.maxScore()),
+		rolls:      newTurnRolls(rules),
+	}
+	m.pReach = m.rolls.reachProbs(rules.numScores())
+	for onBoard := range m.turnCDF {
+		table := NewTable(1)
+		table.PlayerScores[0] = uint16(onBoard)
+		dist := CalcTurnDistribution(rules, table, strategy)
+		probs := make([]float64, rules.numScores())
+		probs[0] = dist.PFarkle
+		for _, o := range dist.Outcomes {
+			probs[min(o.Points/rules.scoreIncrement(), m.maxScore)] += o.Prob
+		}
+		m.turnCDF[onBoard] = make([]float64, len(probs))
+		cdf := 0.0
+		for points, p := range probs {
+			cdf += p
+			m.turnCDF[onBoard][points] = cdf
+		}
+	}
+
+	return m, nil
+}
+
+// Probability that an opponent starting from the given score
+// fails to beat the target score in one turn. A target at the highest
+// score can only be tied, which is valued as a tie of two players.
+func (m *approxModel) pFailToBeat(target, from int) float64 {
+	if target >= m.maxScore {
+		pTie := m.pReach[max(m.maxScore-from, 0)]
+		return 1 - pTie*(1-m.rules.tieValue(2))
+	}
+	return 1 - m.pReach[max(target-from+1, 0)]
+}
+
+// Probability that an opponent starting from the given score has
+// at most the given score after one turn.
+func (m *approxModel) pAtMost(score, from int) float64 {
+	if score >= m.maxScore {
+		return 1
+	} else if score < from {
+		return 0
+	}
+	return m.turnCDF[boolToInt(from > 0)][score-from]
+}
+
+// Distribution of the leader's score after every opponent plays a turn.
+func (m *approxModel) nextLeaderProbs(leader, others int) []float64 {
+	probs := make([]float64, m.maxScore+1)
+	prev := 0.0
+	for score := leader; score <= m.maxScore; score++ {
+		cdf := m.pAtMost(score, leader) *
+			math.Pow(m.pAtMost(score, others), float64(m.numPlayers-2))
+		probs[score] = cdf - prev
+		prev = cdf
+	}
+	return probs
+}
+
+// Value of banking in the final round with the given score this round,
+// the given deficit to the leader, and numLeft opponents still to play.
+func (m *approxModel) finalStopValue(scoreThisRound, deficit, numLeft int) float64 {
+	if scoreThisRound < deficit {
+		return 0
+	}
+	// The opponents left start from the same score as the player.
+	p := math.Pow(m.pFailToBeat(scoreThisRound, 0), float64(numLeft))
+	if scoreThisRound == deficit {
+		// Tied with the leader.
+		p *= m.rules.tieValue(2)
+	}
+	return p
+}
+
+// Value of banking the given score before the final round, when it
+// reaches the score to win: every opponent gets one more turn to beat it.
+func (m *approxModel) winningStopValue(banked, leader, others int) float64 {
+	return m.pFailToBeat(banked, leader) *
+		math.Pow(m.pFailToBeat(banked, others), float64(m.numPlayers-2))
+}
+
+// ApproxDB is an approximate solution for games with any number of players,
+// storing the win probability of the current player in every ApproxState.
+// It is stored like an exact solution, with a DBHeader of kind ApproxSolution
+// followed by the values with Float32Encoding ordered by state ID.
+type ApproxDB struct {
+	header DBHeader
+	model  *approxModel
+	// Values are either in memory or memory-mapped from a file.
+	values []byte
+	f      *os.File
+	mmap   []byte
+}
+
+// Header for a new approximate solution.
+func newApproxDBHeader(rules *Rules, numPlayers int, opponent string) DBHeader {
+	header := newDBHeader(rules, numPlayers, Float32Encoding)
+	header.Kind = ApproxSolution
+	header.Opponent = opponent
+	return header
+}
+
+// Solve an approximate solution for the given number of players, modeling
+// the opponents with the given heuristic strategy.
+func SolveApprox(rules *Rules, numPlayers int, opponent string) (*ApproxDB, error) {
+	model, err := newApproxModel(rules, numPlayers, opponent)
+	if err != nil {
+		return nil, err
+	}
+
+	numStates := numApproxStates(rules, numPlayers)
+	glog.Infof("Solving approximate solution with %d states", numStates)
+	db := &ApproxDB{
+		header: newApproxDBHeader(rules, numPlayers, opponent),
+		model:  model,
+		values: make([]byte, 4*numStates),
+	}
+
+	db.solveFinalRound()
+	db.solveBeforeFinalRound()
+	db.header.Checksum = checksum(db.values)
+	return db, nil
+}
+
+// Solve the last turn of every player in the final round,
+// which only depends on when they stop.
+func (db *ApproxDB) solveFinalRound() {
+	m := db.model
+	for numLeft := 0; numLeft < m.numPlayers-1; numLeft++ {
+		for deficit := 1; deficit <= m.maxScore; deficit++ {
+			stopValues := make([]float64, m.maxScore+1)
+			for score := range stopValues {
+				stopValues[score] = m.finalStopValue(score, deficit, numLeft)
+			}
+			// Farkling loses.
+			values, _ := m.rolls.solveTurn(stopValues, 0, false)
+			state := ApproxState{
+				Score:             0,
+				LeaderScore:       uint16(deficit),
+				FinalRound:        true,
+				NumFinalTurnsLeft: uint8(numLeft),
+			}
+			db.putTurn(state, values)
+		}
+	}
+}
+
+// Solve every turn before the final round. A turn only leads to states
+// with a higher score or leader score, except when everyone farkles, so
+// turns are solved in decreasing order of the sum of both. Turns with the
+// same sum are independent and solved concurrently.
+func (db *ApproxDB) solveBeforeFinalRound() {
+	win := int(db.model.rules.scoreToWin())
+	for sum := 2 * (win - 1); sum >= 0; sum-- {
+		scoreCh := make(chan int)
+		var wg sync.WaitGroup
+		for i := 0; i < runtime.NumCPU(); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for score := range scoreCh {
+					db.solveTurn(score, sum-score)
+				}
+			}()
+		}
+		for score := max(sum-win+1, 0); score <= min(sum, win-1); score++ {
+			scoreCh <- score
+		}
+		close(scoreCh)
+		wg.Wait()
+
+		if sum%10 == 0 {
+			glog.Infof("Solved turns with score + leader score = %d", sum)
+		}
+	}
+}
+
+// Solve the turn of a player with the given score and leader score.
+func (db *ApproxDB) solveTurn(score, leader int) {
+	m := db.model
+	others := min(score, leader)
+	leaderProbs := m.nextLeaderProbs(leader, others)
+
+	stopValues := make([]float64, m.maxScore+1)
+	stopValues[0] = math.NaN()
+	for scoreThisRound := 1; scoreThisRound <= m.maxScore; scoreThisRound++ {
+		if score == 0 && scoreThisRound < int(m.rules.minOpeningScore()) {
+			stopValues[scoreThisRound] = math.NaN()
+			continue
+		}
+		banked := min(score+scoreThisRound, m.maxScore)
+		if banked >= int(m.rules.scoreToWin()) {
+			stopValues[scoreThisRound] = m.winningStopValue(banked, leader, others)
+		} else {
+			stopValues[scoreThisRound] = db.afterTurnValue(banked, leaderProbs, leader)
+		}
+	}
+
+	// After farkling, if every opponent also fails to increase the
+	// leader score, the player is back at the start of this turn.
+	// The value of the turn V then satisfies V = value(farkle(V)),
+	// which is solved with Newton's method.
+	pSame := leaderProbs[leader]
+	farkleRest := db.afterTurnValue(score, leaderProbs, leader+1)
+	start := 1 / float64(m.numPlayers)
+	var values turnTable
+	for i := 0; i < 100; i++ {
+		var pFarkle turnTable
+		values, pFarkle = m.rolls.solveTurn(stopValues, farkleRest+pSame*start, false)
+		g := values[0][MaxNumDice] - start
+		next := start - g/(pSame*pFarkle[0][MaxNumDice]-1)
+		if math.Abs(next-start) < 1e-12 {
+			break
+		}
+		start = next
+	}
+
+	db.putTurn(ApproxState{Score: uint16(score), LeaderScore: uint16(leader)}, values)
+}
+
+// Value of banking the given score before the final round, from the
+// leader score after the opponents play their turns. Only leader scores
+// of at least minLeader are included.
+func (db *ApproxDB) afterTurnValue(banked int, leaderProbs []float64, minLeader int) float64 {
+	m := db.model
+	win := int(m.rules.scoreToWin())
+	value := 0.0
+	for leader := minLeader; leader <= m.maxScore; leader++ {
+		p := leaderProbs[leader]
+		if p == 0 {
+			continue
+		}
+
+		state := ApproxState{
+			NumDiceToRoll: MaxNumDice,
+			Score:         uint16(banked),
+			LeaderScore:   uint16(leader),
+		}
+		if leader < win {
+			value += p * db.get(state)
+			continue
+		}
+
+		// The final round has started, and the player is equally
+		// likely to have any number of opponents left after them.
+		state.FinalRound = true
+		for numLeft := 0; numLeft < m.numPlayers-1; numLeft++ {
+			state.NumFinalTurnsLeft = uint8(numLeft)
+			value += p * db.get(state) / float64(m.numPlayers-1)
+		}
+	}
+	return value
+}
+
+// Store the values of every state in a turn.
+func (db *ApproxDB) putTurn(state ApproxState, values turnTable) {
+	for score := range values {
+		for numDice := 1; numDice <= MaxNumDice; numDice++ {
+			state.ScoreThisRound = uint16(score)
+			state.NumDiceToRoll = uint8(numDice)
+			idx := 4 * state.id(db.model.rules)
+			Float32Encoding.encode(db.values[idx:idx+4], values[score][numDice])
+		}
+	}
+}
+
+func (db *ApproxDB) get(state ApproxState) float64 {
+	idx := 4 * state.id(db.model.rules)
+	return Float32Encoding.decode(db.values[idx : idx+4])
+}
+
+// The header describing this solution.
+func (db *ApproxDB) Header() DBHeader {
+	return db.header
+}
+
+// The number of game players.
+func (db *ApproxDB) NumPlayers() int {
+	return db.header.NumPlayers
+}
+
+// Win probability of the current player at the given table,
+// where the game must not be over.
+func (db *ApproxDB) WinProb(table Table) float64 {
+	return db.get(AbstractTable(db.header.Rules, table))
+}
+
+// Find the action that maximizes the current player's approximate win
+// probability after the given roll, and its value. If the roll is a
+// farkle, the action is the zero Action.
+func (db *ApproxDB) SelectAction(table Table, roll Roll) (Action, float64) {
+	rules := db.header.Rules
+	a := AbstractTable(rules, table)
+	tables := rules.Scoring.getTables()
+	potentialActions := tables.potentialActions[GetRollID(roll)]
+	if len(potentialActions) == 0 {
+		return Action{}, db.farkleValue(a)
+	}
+
+	var bestAction Action
+	bestValue := math.Inf(-1)
+	for _, action := range potentialActions {
+		newTable := ApplyTableAction(rules, table, Action{HeldDiceID: action.HeldDiceID, ContinueRolling: true})
+		continueRolling := action.ContinueRolling && newTable.ScoreThisRound < rules.maxScore()
+		var value float64
+		if continueRolling {
+			next := a
+			next.ScoreThisRound = newTable.ScoreThisRound
+			next.NumDiceToRoll = newTable.NumDiceToRoll
+			value = db.get(next)
+		} else if table.CanStop(rules, action.HeldDiceID) {
+			// As in the solver, continuing to roll once the score
+			// this round has overflowed is approximated as stopping.
+			value = db.stopValue(a, int(newTable.ScoreThisRound))
+		} else {
+			continue
+		}
+
+		if value > bestValue {
+			bestAction = Action{HeldDiceID: action.HeldDiceID, ContinueRolling: continueRolling}
+			bestValue = value
+		}
+	}
+
+	return bestAction, bestValue
+}
+
+// Value of banking the given score this round.
+func (db *ApproxDB) stopValue(a ApproxState, scoreThisRound int) float64 {
+	m := db.model
+	score, leader := int(a.Score), int(a.LeaderScore)
+	if a.FinalRound {
+		return m.finalStopValue(scoreThisRound, leader-score, int(a.NumFinalTurnsLeft))
+	}
+
+	others := min(score, leader)
+	banked := min(score+scoreThisRound, m.maxScore)
+	if banked >= int(m.rules.scoreToWin()) {
+		return m.winningStopValue(banked, leader, others)
+	}
+	leaderProbs := m.nextLeaderProbs(leader, others)
+	return db.afterTurnValue(banked, leaderProbs, leader)
+}
+
+// Value of farkling.
+func (db *ApproxDB) farkleValue(a ApproxState) float64 {
+	if a.FinalRound {
+		return 0
+	}
+	score, leader := int(a.Score), int(a.LeaderScore)
+	leaderProbs := db.model.nextLeaderProbs(leader, min(score, leader))
+	return db.afterTurnValue(score, leaderProbs, leader)
+}
+
+// Write the solution to a file.
+func (db *ApproxDB) Save(path string) error {
+	header, err := db.header.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriterSize(f, 4*1024*1024)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(db.values); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Open an approximate solution for reading. It is an error if it
+// was solved with different rules or number of players.
+func OpenApproxDB(path string, rules *Rules, numPlayers int) (*ApproxDB, error) {
+	header, err := ReadDBHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	// Any opponent model may be used.
+	expected := newApproxDBHeader(rules, numPlayers, header.Opponent)
+	if err := header.checkCompatible(expected); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	model, err := newApproxModel(header.Rules, header.NumPlayers, header.Opponent)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fileSize := int64(dbHeaderSize + 4*numApproxStates(header.Rules, header.NumPlayers))
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	} else if stat.Size() != fileSize {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s is not the correct size for %d-player approximate solution: "+
+			"got %d, expected %d", path, header.NumPlayers, stat.Size(), fileSize)
+	}
+
+	mmap, err := unix.Mmap(int(f.Fd()), 0, int(fileSize), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	db := &ApproxDB{
+		header: header,
+		model:  model,
+		values: mmap[dbHeaderSize:],
+		f:      f,
+		mmap:   mmap,
+	}
+	if err := db.VerifyChecksum(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// Check that the values match the checksum in the header.
+func (db *ApproxDB) VerifyChecksum() error {
+	if got := checksum(db.values); got != db.header.Checksum {
+		return fmt.Errorf("approximate solution checksum mismatch: got %08x, expected %08x",
+			got, db.header.Checksum)
+	}
+	return nil
+}
+
+func (db *ApproxDB) Close() error {
+	if db.f == nil {
+		return nil
+	}
+	defer db.f.Close()
+	if err := unix.Munmap(db.mmap); err != nil {
+		return err
+	}
+	return db.f.Close()
+}
+
+// Strategy that plays according to an approximate solution.
+type ApproxStrategy struct {
+	db *ApproxDB
+}
+
+func NewApproxStrategy(db *ApproxDB) *ApproxStrategy {
+	return &ApproxStrategy{db: db}
+}
+
+func (s *ApproxStrategy) ChooseAction(table Table, roll Roll) Action {
+	action, _ := s.db.SelectAction(table, roll)
+	return action
+}
@@ -0,0 +1,71 @@
+package farkle
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Rules with a minimum opening score for a game small enough
+// to solve exactly in a test for up to three players.
+var smallApproxRules = &Rules{
+	Scoring: &ScoringRules{
+		Name: "small",
+		TrickScores: [numTrickTypes]int{
+			Single1: 100,
+			Single5: 100,
+			Three1s: 300,
+		},
+	},
+	ScoreToWin:      300,
+	MinOpeningScore: 200,
+	ScoreIncrement:  100,
+}
+
+// The approximate solution models the opponents with a heuristic strategy
+// rather than solving them, so its values are not those of the exact
+// solution. Its choices should still be close to optimal: compare the win
+// probability they give up against the exact solution in every state.
+func TestApproxMatchesExact(t *testing.T) {
+	const maxMeanRegret = 0.002
+	for _, numPlayers := range []int{2, 3} {
+		t.Run(fmt.Sprintf("%d players", numPlayers), func(t *testing.T) {
+			statesPath := gameStatesFile(t, smallApproxRules, numPlayers)
+			exact := NewMemDB(smallApproxRules, numPlayers)
+			solveGame(t, smallApproxRules, numPlayers, exact, statesPath)
+			approx, err := SolveApprox(smallApproxRules, numPlayers, "greedy")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			initial := NewGameState(numPlayers)
+			got, expected := approx.WinProb(initial.Table()), exact.Get(initial)[0]
+			t.Logf("initial win probability: approximate %v, exact %v", got, expected)
+			if numPlayers == 2 && got < expected-1e-6 {
+				// The only opponent can do no better than playing optimally.
+				t.Errorf("approximate win probability %v is less than exact %v", got, expected)
+			}
+
+			var regret float64
+			n := 0
+			for _, state := range iterGameStatesFile(t, smallApproxRules, numPlayers, statesPath) {
+				if state.IsGameOver(smallApproxRules) {
+					continue
+				}
+				for _, roll := range allRolls[state.NumDiceToRoll] {
+					action, _ := approx.SelectAction(state.Table(), roll.Roll)
+					ranked, ok := RankActions(smallApproxRules, state, roll.ID, exact).Find(action)
+					if !ok {
+						t.Fatalf("state %s, roll %v: approximate action %v is not legal",
+							smallApproxRules.FormatState(state), roll.Roll, action)
+					}
+					regret -= roll.Prob * ranked.Delta
+				}
+				n++
+			}
+			if mean := regret / float64(n); mean > maxMeanRegret {
+				t.Errorf("approximate strategy gives up %v win probability per state on average, expected <= %v",
+					mean, maxMeanRegret)
+			}
+		})
+	}
+}
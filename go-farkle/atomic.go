@@ -0,0 +1,98 @@
+package farkle
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Values in database files are little-endian, but are loaded and stored
+// atomically as native words, so their bytes are swapped on big-endian hosts.
+var bigEndianHost = binary.NativeEndian.Uint16([]byte{0, 1}) == 1
+
+// Atomically load the little-endian uint64 at the start of buf,
+// which must be 8-byte aligned.
+func atomicLoadUint64(buf []byte) uint64 {
+	_ = buf[7]
+	x := atomic.LoadUint64((*uint64)(unsafe.Pointer(&buf[0])))
+	if bigEndianHost {
+		x = bits.ReverseBytes64(x)
+	}
+	return x
+}
+
+// Atomically store a little-endian uint64 at the start of buf,
+// which must be 8-byte aligned.
+func atomicStoreUint64(buf []byte, x uint64) {
+	_ = buf[7]
+	if bigEndianHost {
+		x = bits.ReverseBytes64(x)
+	}
+	atomic.StoreUint64((*uint64)(unsafe.Pointer(&buf[0])), x)
+}
+
+// Atomically load the little-endian uint32 at the start of buf,
+// which must be 4-byte aligned.
+func atomicLoadUint32(buf []byte) uint32 {
+	_ = buf[3]
+	x := atomic.LoadUint32((*uint32)(unsafe.Pointer(&buf[0])))
+	if bigEndianHost {
+		x = bits.ReverseBytes32(x)
+	}
+	return x
+}
+
+// Atomically store a little-endian uint32 at the start of buf,
+// which must be 4-byte aligned.
+func atomicStoreUint32(buf []byte, x uint32) {
+	_ = buf[3]
+	if bigEndianHost {
+		x = bits.ReverseBytes32(x)
+	}
+	atomic.StoreUint32((*uint32)(unsafe.Pointer(&buf[0])), x)
+}
+
+// There are no 16-bit atomic operations, so uint16 values are loaded
+// and stored through the aligned 32-bit word that contains them, and
+// buf must be 2-byte aligned. The word extends past the end of buf for
+// a value at the start of a word, so the capacity of buf must cover the
+// rest of the word: the values of a database file are padded to a
+// multiple of 4 bytes for the final half-word (see dbValuesSize).
+func containingWord(buf []byte) (word *uint32, shift uint) {
+	_ = buf[1]
+	offset := uintptr(unsafe.Pointer(&buf[0])) & 3
+	_ = buf[:4-offset]
+	word = (*uint32)(unsafe.Add(unsafe.Pointer(&buf[0]), -int(offset)))
+	if bigEndianHost {
+		return word, uint(8 * (2 - offset))
+	}
+	return word, uint(8 * offset)
+}
+
+// Atomically load the little-endian uint16 at the start of buf.
+func atomicLoadUint16(buf []byte) uint16 {
+	word, shift := containingWord(buf)
+	x := uint16(atomic.LoadUint32(word) >> shift)
+	if bigEndianHost {
+		x = bits.ReverseBytes16(x)
+	}
+	return x
+}
+
+// Atomically store a little-endian uint16 at the start of buf.
+func atomicStoreUint16(buf []byte, x uint16) {
+	word, shift := containingWord(buf)
+	if bigEndianHost {
+		x = bits.ReverseBytes16(x)
+	}
+	mask := uint32(math.MaxUint16) << shift
+	for {
+		old := atomic.LoadUint32(word)
+		updated := old&^mask | uint32(x)<<shift
+		if atomic.CompareAndSwapUint32(word, old, updated) {
+			return
+		}
+	}
+}
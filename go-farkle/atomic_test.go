@@ -0,0 +1,63 @@
+package farkle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+// The bytes of the given words, which are 4-byte aligned.
+func wordBytes(words []uint32) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), 4*len(words))
+}
+
+func TestAtomicUint16(t *testing.T) {
+	words := make([]uint32, 2)
+	buf := wordBytes(words)
+	for i := 0; i < len(buf); i += 2 {
+		atomicStoreUint16(buf[i:], uint16(0x0101*(i+1)))
+	}
+	for i := 0; i < len(buf); i += 2 {
+		if got, expected := atomicLoadUint16(buf[i:]), uint16(0x0101*(i+1)); got != expected {
+			t.Errorf("offset %d: got %#04x, expected %#04x", i, got, expected)
+		}
+	}
+}
+
+func TestAtomicUint16FinalHalfWord(t *testing.T) {
+	words := make([]uint32, 2)
+	// The value at offset 4 is the last in buf, but its word is not.
+	buf := wordBytes(words)[:6:6]
+	defer func() {
+		if recover() == nil {
+			t.Errorf("stored past the end of the buffer")
+		}
+		if words[1] != 0 {
+			t.Errorf("word past the end of the buffer was modified: %#08x", words[1])
+		}
+	}()
+	atomicStoreUint16(buf[4:], 0xffff)
+}
+
+func TestWriteDBFilePadsValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "odd.db")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	header := newDBHeader(DefaultRules, 2, Uint16Encoding)
+	entry := []byte{1, 2}
+	if err := writeDBFile(f, header, 3, func(int) []byte { return entry }); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := stat.Size(), int64(dbHeaderSize+dbValuesSize(len(entry), 3)); got != expected || expected%4 != 0 {
+		t.Errorf("file is %d bytes, expected %d", got, expected)
+	}
+}
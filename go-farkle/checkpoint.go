@@ -0,0 +1,80 @@
+package farkle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+)
+
+// Checkpoint records the progress of value iteration on a database,
+// so that an interrupted solve can be resumed.
+type Checkpoint struct {
+	// Number of completed value iteration cycles, as recorded in the
+	// header of the database this checkpoint is for.
+	NumIterations int
+	// Whether a value iteration cycle was interrupted. If so, all game
+	// states with depth >= LastCompletedDepth have been updated.
+	InProgress         bool
+	LastCompletedDepth uint16
+	// Statistics of the interrupted cycle so far.
+	Stats UpdateStats
+	// Max residual of each completed value iteration cycle.
+	Residuals []float64
+}
+
+// Path of the checkpoint for the database at the given path.
+func CheckpointPath(dbPath string) string {
+	return dbPath + ".checkpoint"
+}
+
+// Load a checkpoint, returning an empty Checkpoint if the file does not exist.
+func LoadCheckpoint(path string) (Checkpoint, error) {
+	var cp Checkpoint
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	} else if err != nil {
+		return cp, err
+	}
+
+	if err := json.Unmarshal(buf, &cp); err != nil {
+		return cp, fmt.Errorf("%s: error parsing checkpoint: %w", path, err)
+	}
+	return cp, nil
+}
+
+// Save the checkpoint to the given path. The file is replaced atomically,
+// so that an existing checkpoint is not lost if saving fails.
+func (cp Checkpoint) Save(path string) error {
+	buf, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Skip all game states that the checkpoint records as already updated
+// in the interrupted value iteration cycle.
+func (cp Checkpoint) SkipCompleted(states iter.Seq2[uint16, GameState]) iter.Seq2[uint16, GameState] {
+	if !cp.InProgress {
+		return states
+	}
+
+	return func(yield func(uint16, GameState) bool) {
+		for depth, state := range states {
+			if depth >= cp.LastCompletedDepth {
+				continue
+			}
+			if !yield(depth, state) {
+				return
+			}
+		}
+	}
+}
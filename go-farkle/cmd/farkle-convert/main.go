@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/timpalpant/go-farkle"
+)
+
+type Params struct {
+	InputPath  string
+	OutputPath string
+	Encoding   string
+	// Number of players of a legacy input database without a header.
+	LegacyPlayers int
+}
+
+func main() {
+	var params Params
+	flag.StringVar(&params.InputPath, "in", "2player.db", "Path to float64 solution database")
+	flag.StringVar(&params.OutputPath, "out", "2player.q16.db", "Path to quantized database to create")
+	flag.StringVar(&params.Encoding, "encoding", farkle.Uint16Encoding.String(),
+		"Encoding of win probabilities in the output: float32, uint32 or uint16")
+	flag.IntVar(&params.LegacyPlayers, "legacy_players", 0,
+		"If > 0, -in is a database solved for this many players before databases had a header, "+
+			"which is copied to -out with a header instead of being converted")
+	flag.Parse()
+
+	if params.LegacyPlayers > 0 {
+		if err := farkle.ConvertLegacyDB(params.InputPath, params.OutputPath, params.LegacyPlayers); err != nil {
+			glog.Errorf("Error converting legacy database: %v", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Added a header to legacy database %s in %s\n", params.InputPath, params.OutputPath)
+		return
+	}
+
+	encoding, err := farkle.ParseValueEncoding(params.Encoding)
+	if err != nil {
+		glog.Errorf("Invalid encoding: %v", err)
+		os.Exit(1)
+	}
+
+	header, err := farkle.ReadDBHeader(params.InputPath)
+	if err != nil {
+		glog.Errorf("Unable to read database header: %v", err)
+		os.Exit(1)
+	}
+	if header.Encoding != farkle.Float64Encoding {
+		glog.Errorf("%s has %v encoding, expected %v",
+			params.InputPath, header.Encoding, farkle.Float64Encoding)
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(params.OutputPath); err == nil {
+		glog.Errorf("%s already exists", params.OutputPath)
+		os.Exit(1)
+	}
+
+	src, err := farkle.OpenFileDBReadOnly(params.InputPath, header.Rules, header.NumPlayers)
+	if err != nil {
+		glog.Errorf("Unable to open input database: %v", err)
+		os.Exit(1)
+	}
+	defer src.Close()
+
+	dst, err := farkle.NewQuantizedDB(params.OutputPath, header.Rules, header.NumPlayers, encoding)
+	if err != nil {
+		glog.Errorf("Unable to create output database: %v", err)
+		os.Exit(1)
+	}
+
+	maxErr, err := farkle.ConvertDB(src, dst)
+	if err != nil {
+		glog.Errorf("Error converting database: %v", err)
+		os.Exit(1)
+	}
+
+	if err := dst.Close(); err != nil {
+		glog.Errorf("Error closing output database: %v", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Converted %s to %v encoding in %s\n", params.InputPath, encoding, params.OutputPath)
+	fmt.Printf("Maximum absolute error in win probability: %g\n", maxErr)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/timpalpant/go-farkle"
+)
+
+type Params struct {
+	DBPath string
+	Verify bool
+}
+
+func main() {
+	var params Params
+	flag.StringVar(&params.DBPath, "db", "2player.db", "Path to solution database")
+	flag.BoolVar(&params.Verify, "verify", false, "Verify the checksum of the stored values")
+	flag.Parse()
+
+	header, err := farkle.ReadDBHeader(params.DBPath)
+	if err != nil {
+		glog.Errorf("Unable to read database header: %v", err)
+		os.Exit(1)
+	}
+
+	printHeader(header)
+
+	if params.Verify {
+		if header.Dirty {
+			fmt.Println("Checksum:           NOT VERIFIED (database was not closed cleanly)")
+			return
+		} else if header.Kind == farkle.SortedStateList {
+			fmt.Println("Checksum:           NOT VERIFIED (game states have no checksum)")
+			return
+		}
+
+		// Opening a database verifies its checksum.
+		db, err := openDB(params.DBPath, header)
+		if err != nil {
+			fmt.Printf("Checksum:           FAILED (%v)\n", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+		fmt.Println("Checksum:           OK")
+	}
+}
+
+func openDB(path string, h farkle.DBHeader) (io.Closer, error) {
+	if h.Kind == farkle.ApproxSolution {
+		return farkle.OpenApproxDB(path, h.Rules, h.NumPlayers)
+	}
+	return farkle.OpenDBReadOnly(path, h.Rules, h.NumPlayers, h.Encoding)
+}
+
+func printHeader(h farkle.DBHeader) {
+	fmt.Printf("Format version:     %d\n", h.Version)
+	fmt.Printf("Solution:           %v\n", h.Kind)
+	fmt.Printf("Number of players:  %d\n", h.NumPlayers)
+	fmt.Printf("Score increment:    %d\n", h.ScoreIncrement)
+	fmt.Printf("Score width:        %d bytes\n", h.Rules.ScoreWidth)
+	fmt.Printf("Max score:          %d\n", h.MaxScore)
+	fmt.Printf("Score to win:       %d\n", h.Rules.ScoreToWin)
+	fmt.Printf("Min opening score:  %d\n", h.Rules.MinOpeningScore)
+	fmt.Printf("Farkle penalty:     %d\n", h.Rules.FarklePenalty)
+	fmt.Printf("Tie-break policy:   %v\n", h.Rules.TieBreak)
+	fmt.Printf("Scoring rules:      %s\n", h.Rules.Scoring.Name)
+	for t, score := range h.Rules.Scoring.TrickScores {
+		fmt.Printf("  %-20s %d\n", farkle.TrickType(t), score)
+	}
+	fmt.Printf("  %-20s %v\n", "DoubleNOfAKind", h.Rules.Scoring.DoubleNOfAKind)
+	fmt.Printf("Value encoding:     %v\n", h.Encoding)
+	if h.Kind == farkle.ApproxSolution {
+		fmt.Printf("Opponent model:     %s\n", h.Opponent)
+	} else {
+		fmt.Printf("Iterations:         %d\n", h.NumIterations)
+		fmt.Printf("Last residual:      %g\n", h.LastResidual)
+	}
+	fmt.Printf("Checksum:           %08x\n", h.Checksum)
+	fmt.Printf("Closed cleanly:     %v\n", !h.Dirty)
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/timpalpant/go-farkle"
+)
+
+type Params struct {
+	DBPath         string
+	GameStatesPath string
+	OutPath        string
+	Format         string
+	Scores         string
+	ScoreThisRound string
+	NumDiceToRoll  string
+}
+
+func main() {
+	var params Params
+	flag.StringVar(&params.DBPath, "db", "2player.db", "Path to solution database")
+	flag.StringVar(&params.GameStatesPath, "games", "",
+		"Path to the sorted game states written by solve-farkle. If not given, "+
+			"the reachable game states are enumerated, which is much slower")
+	flag.StringVar(&params.OutPath, "out", "", "Output file (default stdout)")
+	flag.StringVar(&params.Format, "format", "csv", "Output format: csv or jsonl")
+	flag.StringVar(&params.Scores, "scores", "",
+		"Comma-separated range of banked points of each player, starting with the current player, "+
+			"e.g. 0-1000,* (default any)")
+	flag.StringVar(&params.ScoreThisRound, "score_this_round", "",
+		"Range of points accumulated this turn, e.g. 300 or 0-500 (default any)")
+	flag.StringVar(&params.NumDiceToRoll, "num_dice_to_roll", "",
+		"Range of the number of dice to roll, e.g. 6 or 1-3 (default any)")
+	flag.Parse()
+
+	header, err := farkle.ReadDBHeader(params.DBPath)
+	if err != nil {
+		glog.Errorf("Unable to read database header: %v", err)
+		os.Exit(1)
+	}
+
+	f, err := newFilter(params, header.NumPlayers)
+	if err != nil {
+		glog.Errorf("Invalid filter: %v", err)
+		os.Exit(1)
+	}
+
+	db, err := farkle.OpenDBReadOnly(params.DBPath, header.Rules, header.NumPlayers, header.Encoding)
+	if err != nil {
+		glog.Errorf("Unable to open database: %v", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	states := farkle.ReachableGameStates(header.Rules, header.NumPlayers)
+	if params.GameStatesPath != "" {
+		sorted, err := farkle.IterGameStates(header.Rules, header.NumPlayers, params.GameStatesPath)
+		if err != nil {
+			glog.Errorf("Unable to read game states: %v", err)
+			os.Exit(1)
+		}
+		states = func(yield func(farkle.GameState) bool) {
+			for _, state := range sorted {
+				if !yield(state) {
+					return
+				}
+			}
+		}
+	}
+
+	out := os.Stdout
+	if params.OutPath != "" {
+		out, err = os.Create(params.OutPath)
+		if err != nil {
+			glog.Errorf("Unable to create output file: %v", err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+
+	w := bufio.NewWriterSize(out, 4*1024*1024)
+	var rw rowWriter
+	switch params.Format {
+	case "csv":
+		rw = newCSVWriter(w, header.NumPlayers, header.Rules.FarklePenalty > 0)
+	case "jsonl":
+		rw = &jsonWriter{enc: json.NewEncoder(w)}
+	default:
+		glog.Errorf("Invalid format: %q", params.Format)
+		os.Exit(1)
+	}
+
+	if err := dump(header.Rules, db, states, f, rw); err != nil {
+		glog.Errorf("Error writing output: %v", err)
+		os.Exit(1)
+	}
+	if err := w.Flush(); err != nil {
+		glog.Errorf("Error writing output: %v", err)
+		os.Exit(1)
+	}
+}
+
+// The optimal action after one roll in a game state. Scores are in points.
+type row struct {
+	// Banked score of each player, starting with the current player.
+	Scores             []int       `json:"scores"`
+	ScoreThisRound     int         `json:"score_this_round"`
+	NumDiceToRoll      int         `json:"num_dice_to_roll"`
+	ConsecutiveFarkles []int       `json:"consecutive_farkles,omitempty"`
+	Roll               farkle.Roll `json:"roll"`
+	// Probability of the roll.
+	Prob   float64       `json:"prob"`
+	Action farkle.Action `json:"action"`
+	// Win probability of each player with the optimal action,
+	// in the same order as Scores.
+	WinProb []float64 `json:"win_prob"`
+}
+
+// Write a row for every roll in every game state that matches
+// the filter, in the order the states are enumerated.
+func dump(rules *farkle.Rules, db farkle.DB, states iter.Seq[farkle.GameState], f *filter, w rowWriter) error {
+	numStates := 0
+	for state := range states {
+		if state.IsGameOver(rules) || !f.matches(rules, state) {
+			continue
+		}
+
+		n := int(state.NumPlayers)
+		r := row{
+			Scores:         make([]int, n),
+			ScoreThisRound: rules.Points(state.ScoreThisRound),
+			NumDiceToRoll:  int(state.NumDiceToRoll),
+		}
+		for i, score := range state.PlayerScores[:n] {
+			r.Scores[i] = rules.Points(score)
+		}
+		if rules.FarklePenalty > 0 {
+			r.ConsecutiveFarkles = make([]int, n)
+			for i, farkles := range state.ConsecutiveFarkles[:n] {
+				r.ConsecutiveFarkles[i] = int(farkles)
+			}
+		}
+
+		for _, wRoll := range farkle.AllRolls(int(state.NumDiceToRoll)) {
+			action, pWin := farkle.SelectAction(rules, state, wRoll.ID, db)
+			r.Roll = wRoll.Roll
+			r.Prob = wRoll.Prob
+			r.Action = action
+			r.WinProb = pWin[:n]
+			if err := w.Write(&r); err != nil {
+				return err
+			}
+		}
+
+		numStates++
+		if numStates%100000 == 0 {
+			glog.Infof("Dumped %d game states", numStates)
+		}
+	}
+
+	glog.Infof("Dumped %d game states", numStates)
+	return w.Flush()
+}
+
+type rowWriter interface {
+	Write(r *row) error
+	Flush() error
+}
+
+type jsonWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonWriter) Write(r *row) error {
+	return w.enc.Encode(r)
+}
+
+func (w *jsonWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	header  []string
+	written bool
+	record  []string
+}
+
+func newCSVWriter(w io.Writer, numPlayers int, withFarkles bool) *csvWriter {
+	var header []string
+	for i := 0; i < numPlayers; i++ {
+		header = append(header, fmt.Sprintf("score_%d", i))
+	}
+	header = append(header, "score_this_round", "num_dice_to_roll")
+	if withFarkles {
+		for i := 0; i < numPlayers; i++ {
+			header = append(header, fmt.Sprintf("consecutive_farkles_%d", i))
+		}
+	}
+	header = append(header, "roll", "prob", "held", "continue_rolling")
+	for i := 0; i < numPlayers; i++ {
+		header = append(header, fmt.Sprintf("win_prob_%d", i))
+	}
+	return &csvWriter{w: csv.NewWriter(w), header: header}
+}
+
+func (w *csvWriter) writeHeader() error {
+	if w.written {
+		return nil
+	}
+	w.written = true
+	return w.w.Write(w.header)
+}
+
+func (w *csvWriter) Write(r *row) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	rec := w.record[:0]
+	for _, score := range r.Scores {
+		rec = append(rec, strconv.Itoa(score))
+	}
+	rec = append(rec, strconv.Itoa(r.ScoreThisRound), strconv.Itoa(r.NumDiceToRoll))
+	for _, farkles := range r.ConsecutiveFarkles {
+		rec = append(rec, strconv.Itoa(farkles))
+	}
+	roll, _ := r.Roll.MarshalText()
+	held, _ := r.Action.Held().MarshalText()
+	rec = append(rec, string(roll), strconv.FormatFloat(r.Prob, 'g', -1, 64),
+		string(held), strconv.FormatBool(r.Action.ContinueRolling))
+	for _, p := range r.WinProb {
+		rec = append(rec, strconv.FormatFloat(p, 'g', -1, 64))
+	}
+	w.record = rec
+	return w.w.Write(rec)
+}
+
+func (w *csvWriter) Flush() error {
+	// Even if there were no rows.
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// Inclusive range of values.
+type valueRange struct {
+	lo, hi int
+}
+
+var anyValue = valueRange{0, math.MaxInt}
+
+func (r valueRange) contains(v int) bool {
+	return v >= r.lo && v <= r.hi
+}
+
+// Parse a range such as "300", "0-500" or "*". An empty range matches anything.
+func parseRange(s string) (valueRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "*" {
+		return anyValue, nil
+	}
+
+	loStr, hiStr, isRange := strings.Cut(s, "-")
+	lo, err := strconv.Atoi(loStr)
+	if err != nil {
+		return valueRange{}, fmt.Errorf("invalid range %q: %w", s, err)
+	}
+	hi := lo
+	if isRange {
+		if hi, err = strconv.Atoi(hiStr); err != nil {
+			return valueRange{}, fmt.Errorf("invalid range %q: %w", s, err)
+		}
+	}
+	if hi < lo {
+		return valueRange{}, fmt.Errorf("invalid range %q: %d > %d", s, lo, hi)
+	}
+	return valueRange{lo, hi}, nil
+}
+
+// Game states to dump. Scores are in points.
+type filter struct {
+	scores         []valueRange
+	scoreThisRound valueRange
+	numDiceToRoll  valueRange
+}
+
+func newFilter(params Params, numPlayers int) (*filter, error) {
+	f := &filter{scores: make([]valueRange, numPlayers)}
+	for i := range f.scores {
+		f.scores[i] = anyValue
+	}
+	if params.Scores != "" {
+		ranges := strings.Split(params.Scores, ",")
+		if len(ranges) > numPlayers {
+			return nil, fmt.Errorf("got %d score ranges for %d-player game", len(ranges), numPlayers)
+		}
+		for i, s := range ranges {
+			var err error
+			if f.scores[i], err = parseRange(s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var err error
+	if f.scoreThisRound, err = parseRange(params.ScoreThisRound); err != nil {
+		return nil, err
+	}
+	if f.numDiceToRoll, err = parseRange(params.NumDiceToRoll); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *filter) matches(rules *farkle.Rules, state farkle.GameState) bool {
+	for i, r := range f.scores {
+		if !r.contains(rules.Points(state.PlayerScores[i])) {
+			return false
+		}
+	}
+	return f.scoreThisRound.contains(rules.Points(state.ScoreThisRound)) &&
+		f.numDiceToRoll.contains(int(state.NumDiceToRoll))
+}
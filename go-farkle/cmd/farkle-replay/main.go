@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/timpalpant/go-farkle"
+)
+
+type Params struct {
+	RecordPath string
+	DBPath     string
+	OutPath    string
+	Game       int
+	Step       bool
+	Report     bool
+	NumTop     int
+}
+
+func main() {
+	var params Params
+	flag.StringVar(&params.RecordPath, "record", "game.jsonl", "Path to game record")
+	flag.StringVar(&params.DBPath, "db", "",
+		"If set, evaluate every action against this solution database")
+	flag.StringVar(&params.OutPath, "out", "",
+		"If set, write the re-evaluated game record to this JSON Lines file")
+	flag.IntVar(&params.Game, "game", -1, "Only replay the game with this index in the record (-1 for all)")
+	flag.BoolVar(&params.Step, "step", false, "Wait for enter after each roll")
+	flag.BoolVar(&params.Report, "report", false,
+		"Print a blunder report for all games instead of every roll. Requires -db")
+	flag.IntVar(&params.NumTop, "num_mistakes", 10, "Number of biggest mistakes to list in the report")
+	flag.Parse()
+
+	if params.Report && params.DBPath == "" {
+		glog.Errorf("A database is needed to analyze mistakes")
+		os.Exit(1)
+	}
+
+	f, err := os.Open(params.RecordPath)
+	if err != nil {
+		glog.Errorf("Unable to open game record: %v", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	var out *farkle.GameRecordWriter
+	if params.OutPath != "" {
+		outFile, err := os.Create(params.OutPath)
+		if err != nil {
+			glog.Errorf("Unable to create output record: %v", err)
+			os.Exit(1)
+		}
+		defer outFile.Close()
+		w := bufio.NewWriter(outFile)
+		defer w.Flush()
+		out = farkle.NewGameRecordWriter(w)
+	}
+
+	var db farkle.DB
+	var dbHeader farkle.DBHeader
+	var analysis *farkle.BlunderAnalysis
+	stdin := bufio.NewReader(os.Stdin)
+	gameIdx := 0
+	for game, err := range farkle.ReadGameRecords(f) {
+		if err != nil {
+			glog.Errorf("Error reading game record: %v", err)
+			os.Exit(1)
+		}
+		if params.Game >= 0 && gameIdx != params.Game {
+			gameIdx++
+			continue
+		}
+
+		if params.DBPath != "" && db == nil {
+			// All games are evaluated with the database opened for the first one.
+			dbHeader, err = farkle.ReadDBHeader(params.DBPath)
+			if err != nil {
+				glog.Errorf("Unable to read database header: %v", err)
+				os.Exit(1)
+			}
+			db, err = farkle.OpenDBReadOnly(params.DBPath, game.Header.Rules,
+				game.Header.NumPlayers, dbHeader.Encoding)
+			if err != nil {
+				glog.Errorf("Unable to open database for game %d: %v", gameIdx, err)
+				os.Exit(1)
+			}
+			defer db.Close()
+			analysis = farkle.NewBlunderAnalysis(dbHeader.Rules, db)
+		} else if db != nil && (!dbHeader.Rules.Equal(game.Header.Rules) || dbHeader.NumPlayers != game.Header.NumPlayers) {
+			glog.Errorf("Game %d was played with different rules or number of players than the database", gameIdx)
+			os.Exit(1)
+		}
+
+		if params.Report {
+			err = analysis.AddGame(game)
+			if err == nil && out != nil {
+				// Only replayed to re-evaluate the rolls for -out.
+				err = replay(io.Discard, gameIdx, &game, db, false, stdin)
+			}
+		} else {
+			err = replay(os.Stdout, gameIdx, &game, db, params.Step, stdin)
+		}
+		if err != nil {
+			glog.Errorf("Invalid game %d: %v", gameIdx, err)
+			os.Exit(1)
+		}
+		if out != nil {
+			if err := out.WriteGame(game); err != nil {
+				glog.Errorf("Error writing game record: %v", err)
+				os.Exit(1)
+			}
+		}
+		gameIdx++
+	}
+
+	if params.Report {
+		analysis.WriteReport(os.Stdout, params.NumTop)
+	}
+}
+
+// Print each roll of the game to w, and evaluate it against the
+// database if it is not nil, replacing any previous evaluation.
+func replay(w io.Writer, gameIdx int, game *farkle.GameRecord, db farkle.DB, step bool, stdin *bufio.Reader) error {
+	tables, err := game.Tables()
+	if err != nil {
+		return err
+	}
+
+	h := game.Header
+	fmt.Fprintf(w, "Game %d: %d players %v, dice %s, rules: {%v}\n",
+		gameIdx, h.NumPlayers, h.Players, h.Dice, h.Rules)
+	// Win probability lost by each seat to suboptimal actions.
+	losses := make([]float64, h.NumPlayers)
+	evaluated := false
+	for i := range game.Rolls {
+		rr := &game.Rolls[i]
+		if db != nil {
+			ranked := farkle.RankActions(h.Rules, tables[i].GameState(), farkle.GetRollID(rr.Roll), db)
+			rr.Eval = ranked.Evaluate(rr.Action)
+		}
+
+		fmt.Fprintf(w, "Seat %d, scores %v, %d this round, rolled %s: %v\n",
+			rr.Seat, rr.Scores, rr.ScoreThisRound, rr.Roll, rr.Action)
+		if rr.Eval != nil {
+			evaluated = true
+			delta := rr.Eval.WinProb - rr.Eval.BestWinProb
+			if delta < 0 {
+				fmt.Fprintf(w, "...pWin = %f, optimal action was %v with pWin = %f (%f)\n",
+					rr.Eval.WinProb, rr.Eval.BestAction, rr.Eval.BestWinProb, delta)
+				losses[rr.Seat] -= delta
+			} else {
+				fmt.Fprintf(w, "...optimal (pWin = %f)\n", rr.Eval.WinProb)
+			}
+		}
+		if step {
+			stdin.ReadString('\n')
+		}
+	}
+
+	if len(tables) > 0 {
+		last := len(tables) - 1
+		final := farkle.ApplyTableAction(h.Rules, tables[last], game.Rolls[last].Action)
+		if !final.IsGameOver(h.Rules) {
+			fmt.Fprintln(w, "Game not finished")
+		}
+	}
+	if evaluated {
+		for seat, loss := range losses {
+			fmt.Fprintf(w, "Seat %d lost %f pWin to suboptimal actions\n", seat, loss)
+		}
+	}
+	fmt.Fprintln(w)
+
+	return nil
+}
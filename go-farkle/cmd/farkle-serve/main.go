@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/timpalpant/go-farkle"
+)
+
+type Params struct {
+	DBPath string
+	Addr   string
+}
+
+func main() {
+	var params Params
+	flag.StringVar(&params.DBPath, "db", "2player.db", "Path to solution database")
+	flag.StringVar(&params.Addr, "addr", "localhost:6070", "Address to listen on")
+	flag.Parse()
+
+	header, err := farkle.ReadDBHeader(params.DBPath)
+	if err != nil {
+		glog.Errorf("Unable to read database header: %v", err)
+		os.Exit(1)
+	}
+	glog.Infof("Database: %v", header)
+
+	db, err := farkle.OpenDBReadOnly(params.DBPath, header.Rules, header.NumPlayers, header.Encoding)
+	if err != nil {
+		glog.Errorf("Unable to open database: %v", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	glog.Infof("Listening on %s", params.Addr)
+	server := farkle.NewServer(header.Rules, db)
+	if err := http.ListenAndServe(params.Addr, server); err != nil {
+		glog.Errorf("Error serving: %v", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/timpalpant/go-farkle"
+)
+
+type Params struct {
+	Strategy       string
+	Scores         string
+	ScoreThisRound int
+	NumDiceToRoll  int
+	Scoring        string
+	ScoreToWin     int
+	MinOpening     int
+	FarklePenalty  int
+	ScoreIncrement int
+	ScoreWidth     int
+}
+
+func main() {
+	var params Params
+	flag.StringVar(&params.Strategy, "strategy", "db:2player.db",
+		"Strategy for the rest of the turn, one of: db:<path to solution database> to play optimally, "+
+			strings.Join(farkle.HeuristicStrategyUsage, ", "))
+	flag.StringVar(&params.Scores, "scores", "0,0",
+		"Comma-separated banked points of each player, starting with the current player")
+	flag.IntVar(&params.ScoreThisRound, "score_this_round", 0, "Points accumulated this turn")
+	flag.IntVar(&params.NumDiceToRoll, "num_dice_to_roll", farkle.MaxNumDice, "Number of dice to roll")
+	flag.StringVar(&params.Scoring, "scoring", farkle.StandardScoring.Name,
+		"Scoring rules, one of: "+strings.Join(farkle.ScoringRulesNames(), ", ")+
+			". This and the other rule flags are only needed with a heuristic strategy, "+
+			"since a database records the rules it was solved with")
+	flag.IntVar(&params.ScoreToWin, "score_to_win", farkle.DefaultRules.ScoreToWin,
+		"Score that triggers the final round")
+	flag.IntVar(&params.MinOpening, "min_opening_score", farkle.DefaultRules.MinOpeningScore,
+		"Minimum score in a single turn to get on the board")
+	flag.IntVar(&params.FarklePenalty, "farkle_penalty", 0,
+		"Points deducted after three farkles in a row (0 to disable)")
+	flag.IntVar(&params.ScoreIncrement, "score_increment", farkle.DefaultScoreIncrement,
+		"Points that all scores are multiples of")
+	flag.IntVar(&params.ScoreWidth, "score_width", farkle.DefaultScoreWidth,
+		"Bytes used to store each score (1 or 2)")
+	flag.Parse()
+
+	scores, err := parseScores(params.Scores)
+	if err != nil {
+		glog.Errorf("Invalid scores: %v", err)
+		os.Exit(1)
+	}
+
+	rules, strategy, err := newStrategy(params, len(scores))
+	if err != nil {
+		glog.Errorf("Invalid strategy %q: %v", params.Strategy, err)
+		os.Exit(1)
+	}
+
+	table, err := newTable(rules, scores, params.ScoreThisRound, params.NumDiceToRoll)
+	if err != nil {
+		glog.Errorf("Invalid game state: %v", err)
+		os.Exit(1)
+	}
+	if table.IsGameOver(rules) {
+		glog.Errorf("The game is over in state %s", rules.FormatTable(table))
+		os.Exit(1)
+	}
+
+	dist := farkle.CalcTurnDistribution(rules, table, strategy)
+	fmt.Printf("%s, playing %s\n", rules.FormatTable(table), params.Strategy)
+	fmt.Printf("P(farkle) = %.4f\n", dist.PFarkle)
+	fmt.Printf("Expected points banked = %.1f\n", dist.ExpectedPoints())
+	fmt.Printf("%-8s %-8s %s\n", "Points", "P(=)", "P(>=)")
+	for _, o := range dist.Outcomes {
+		fmt.Printf("%-8d %.4f   %.4f\n", o.Points, o.Prob, dist.PAtLeast(o.Points))
+	}
+}
+
+// Create the strategy with the given specification, and the rules it
+// plays by. A database strategy uses the rules the database was solved with.
+func newStrategy(params Params, numPlayers int) (*farkle.Rules, farkle.Strategy, error) {
+	kind, path, _ := strings.Cut(params.Strategy, ":")
+	if kind == "db" {
+		header, err := farkle.ReadDBHeader(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if header.NumPlayers != numPlayers {
+			return nil, nil, fmt.Errorf("database is for %d players, got %d scores",
+				header.NumPlayers, numPlayers)
+		}
+		if ruleFlagsSet() {
+			flagRules, err := parseRules(params)
+			if err != nil {
+				return nil, nil, err
+			}
+			// There is no flag for the tie-break policy.
+			flagRules.TieBreak = header.Rules.TieBreak
+			if !flagRules.Equal(header.Rules) {
+				return nil, nil, fmt.Errorf("rules set by flags {%v} differ from the rules "+
+					"the database was solved with {%v}", flagRules, header.Rules)
+			}
+		}
+		db, err := farkle.OpenDBReadOnly(path, header.Rules, header.NumPlayers, header.Encoding)
+		if err != nil {
+			return nil, nil, err
+		}
+		// The database is needed until the program exits.
+		return header.Rules, farkle.NewDBStrategy(header.Rules, db), nil
+	}
+
+	rules, err := parseRules(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	strategy, err := farkle.NewHeuristicStrategy(rules, params.Strategy)
+	return rules, strategy, err
+}
+
+// Names of the flags that set the rules.
+var ruleFlags = []string{
+	"scoring", "score_to_win", "min_opening_score", "farkle_penalty",
+	"score_increment", "score_width",
+}
+
+// Whether any of the rule flags were given.
+func ruleFlagsSet() bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || slices.Contains(ruleFlags, f.Name)
+	})
+	return set
+}
+
+// The rules set by the rule flags.
+func parseRules(params Params) (*farkle.Rules, error) {
+	scoring, err := farkle.ScoringRulesByName(params.Scoring)
+	if err != nil {
+		return nil, err
+	}
+	rules := &farkle.Rules{
+		Scoring:         scoring,
+		ScoreToWin:      params.ScoreToWin,
+		MinOpeningScore: params.MinOpening,
+		FarklePenalty:   params.FarklePenalty,
+		ScoreIncrement:  params.ScoreIncrement,
+		ScoreWidth:      params.ScoreWidth,
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Parse a comma-separated list of scores in points.
+func parseScores(s string) ([]int, error) {
+	var scores []int
+	for _, field := range strings.Split(s, ",") {
+		score, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+	return scores, nil
+}
+
+func newTable(rules *farkle.Rules, scores []int, scoreThisRound, numDiceToRoll int) (farkle.Table, error) {
+	if len(scores) < 1 || len(scores) > farkle.MaxNumPlayers {
+		return farkle.Table{}, fmt.Errorf("got %d scores for 1-%d players",
+			len(scores), farkle.MaxNumPlayers)
+	}
+	table := farkle.NewTable(len(scores))
+	for i, score := range scores {
+		units, err := rules.ScoreUnits(score)
+		if err != nil {
+			return table, err
+		}
+		table.PlayerScores[i] = units
+	}
+
+	units, err := rules.ScoreUnits(scoreThisRound)
+	if err != nil {
+		return table, err
+	}
+	table.ScoreThisRound = units
+
+	if numDiceToRoll < 1 || numDiceToRoll > farkle.MaxNumDice {
+		return table, fmt.Errorf("number of dice to roll must be 1-%d, got %d",
+			farkle.MaxNumDice, numDiceToRoll)
+	}
+	table.NumDiceToRoll = uint8(numDiceToRoll)
+	return table, nil
+}
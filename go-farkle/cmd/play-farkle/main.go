@@ -4,8 +4,9 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
-	"math/rand"
+	"io"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/golang/glog"
@@ -13,126 +14,739 @@ import (
 )
 
 type Params struct {
-	NumPlayers int
-	DBPath     string
-	Seed       int64
+	NumPlayers     int
+	DBPath         string
+	Seed           int64
+	Dice           string
+	Scoring        string
+	ScoreToWin     int
+	MinOpening     int
+	FarklePenalty  int
+	ScoreIncrement int
+	ScoreWidth     int
+	TieBreak       string
+	Opponent       string
+	Seats          string
+	Names          string
+	Mode           string
+	RecordPath     string
 }
 
 func main() {
 	var params Params
-	flag.IntVar(&params.NumPlayers, "num_players", 2, "Number of players")
+	flag.IntVar(&params.NumPlayers, "num_players", 2, "Number of players, if -seats is not given")
 	flag.StringVar(&params.DBPath, "db", "2player.db", "Path to solution database")
 	flag.Int64Var(&params.Seed, "seed", 12345, "Random seed")
+	flag.StringVar(&params.Dice, "dice", "seed",
+		"Source of dice rolls, one of: "+strings.Join(farkle.DiceSourceUsage, ", ")+
+			". seed uses -seed unless given")
+	flag.StringVar(&params.Scoring, "scoring", farkle.StandardScoring.Name,
+		"Scoring rules, one of: "+strings.Join(farkle.ScoringRulesNames(), ", ")+
+			". This and the other rule flags are only needed in solitaire or without db or approx players, "+
+			"who play by the rules their database was solved with")
+	flag.IntVar(&params.ScoreToWin, "score_to_win", farkle.DefaultRules.ScoreToWin,
+		"Score that triggers the final round")
+	flag.IntVar(&params.MinOpening, "min_opening_score", farkle.DefaultRules.MinOpeningScore,
+		"Minimum score in a single turn to get on the board")
+	flag.IntVar(&params.FarklePenalty, "farkle_penalty", 0,
+		"Points deducted after three farkles in a row (0 to disable)")
+	flag.IntVar(&params.ScoreIncrement, "score_increment", farkle.DefaultScoreIncrement,
+		"Points that all scores are multiples of")
+	flag.IntVar(&params.ScoreWidth, "score_width", farkle.DefaultScoreWidth,
+		"Bytes used to store each score (1 or 2)")
+	flag.StringVar(&params.TieBreak, "tie_break", farkle.SplitTies.String(),
+		"How a tie for the highest score is valued: split, loss, win or sudden_death. "+
+			"sudden_death is approximate: the extra round is not played out, and each tied "+
+			"player gets their expected share of the win, where only the first player's "+
+			"chance is solved, the others split the rest evenly, and the farkle penalty is ignored")
+	flag.StringVar(&params.Opponent, "opponent", "db",
+		"Strategy of cpu seats: db to play optimally using the database, "+
+			"approx:<path> to play an approximate solution, or one of: "+
+			strings.Join(farkle.HeuristicStrategyUsage, ", "))
+	flag.StringVar(&params.Seats, "seats", "",
+		"Comma-separated player in each seat in order of play: human, cpu to play -opponent, db, "+
+			"approx:<path to approximate solution>, or one of: "+
+			strings.Join(farkle.HeuristicStrategyUsage, ", ")+
+			". Defaults to a human followed by -num_players - 1 cpus")
+	flag.StringVar(&params.Names, "names", "",
+		"Comma-separated name of the player in each seat (default Player N for humans, CPU N for computers)")
+	flag.StringVar(&params.Mode, "mode", "game",
+		"game to play against the computer, or solitaire to reach the score to win in as few turns as possible")
+	flag.StringVar(&params.RecordPath, "record", "",
+		"If set, write a record of the game to this JSON Lines file")
 	flag.Parse()
 
-	db, err := farkle.NewFileDB(params.DBPath, params.NumPlayers)
+	dice, err := farkle.ParseDiceSource(params.Dice, params.Seed)
 	if err != nil {
-		glog.Errorf("Unable to initialize database: %v", err)
+		glog.Errorf("Invalid dice source: %v", err)
 		os.Exit(1)
 	}
 
-	rand.Seed(params.Seed)
-	playGame(db, params.NumPlayers)
+	// The dice source that reproduces this game.
+	diceSpec := params.Dice
+	if diceSpec == "seed" {
+		diceSpec = fmt.Sprintf("seed:%d", params.Seed)
+	}
+
+	if params.Mode == "solitaire" {
+		rules, err := parseRules(params)
+		if err != nil {
+			glog.Errorf("Invalid rules: %v", err)
+			os.Exit(1)
+		}
+		rec, err := newRecorder(params.RecordPath, farkle.GameRecordHeader{
+			Rules:      rules,
+			NumPlayers: 1,
+			Dice:       diceSpec,
+			Players:    []string{"human"},
+		})
+		if err != nil {
+			glog.Errorf("Unable to create game record: %v", err)
+			os.Exit(1)
+		}
+		defer rec.Close()
+
+		fmt.Println("Solving solitaire game...")
+		table := farkle.NewSolitaireTable(rules)
+		table.SolveTurns()
+		if err := playSolitaire(rules, table, dice, rec); err != nil {
+			glog.Errorf("Unable to continue the game: %v", err)
+			rec.Close()
+			os.Exit(1)
+		}
+		return
+	} else if params.Mode != "game" {
+		glog.Errorf("Invalid mode: %q", params.Mode)
+		os.Exit(1)
+	}
+
+	players, err := parseSeats(params.Seats, params.Names, params.NumPlayers, params.Opponent)
+	if err != nil {
+		glog.Errorf("Invalid seats: %v", err)
+		os.Exit(1)
+	}
+	needDB := false
+	for _, p := range players {
+		needDB = needDB || p.spec == "db"
+	}
+	rules, err := playerRules(params, players)
+	if err != nil {
+		glog.Errorf("Invalid rules: %v", err)
+		os.Exit(1)
+	}
+
+	// A database is only needed without optimal computer
+	// players to evaluate the human players' actions.
+	var db farkle.DB
+	if params.DBPath != "" || needDB {
+		db, err = openDB(params.DBPath, rules, len(players))
+		if err != nil && needDB {
+			glog.Errorf("Unable to open database: %v", err)
+			os.Exit(1)
+		} else if err != nil {
+			glog.Warningf("Unable to open database, actions will not be evaluated: %v", err)
+			db = nil
+		}
+	}
+
+	names := make([]string, len(players))
+	for i := range players {
+		p := &players[i]
+		names[i] = p.name
+		if p.spec == "human" {
+			continue
+		} else if p.spec == "db" {
+			p.strategy = farkle.NewDBStrategy(rules, db)
+		} else if path, ok := strings.CutPrefix(p.spec, "approx:"); ok {
+			adb, err := farkle.OpenApproxDB(path, rules, len(players))
+			if err != nil {
+				glog.Errorf("Unable to open approximate solution for %s: %v", p.name, err)
+				os.Exit(1)
+			}
+			defer adb.Close()
+			p.strategy = farkle.NewApproxStrategy(adb)
+		} else if p.strategy, err = farkle.NewHeuristicStrategy(rules, p.spec); err != nil {
+			glog.Errorf("Invalid strategy for %s: %v", p.name, err)
+			os.Exit(1)
+		}
+	}
+
+	rec, err := newRecorder(params.RecordPath, farkle.GameRecordHeader{
+		Rules:      rules,
+		NumPlayers: len(players),
+		Dice:       diceSpec,
+		Players:    names,
+	})
+	if err != nil {
+		glog.Errorf("Unable to create game record: %v", err)
+		os.Exit(1)
+	}
+	defer rec.Close()
+
+	if err := playGame(rules, db, players, dice, rec); err != nil {
+		glog.Errorf("Unable to continue the game: %v", err)
+		rec.Close()
+		os.Exit(1)
+	}
+}
+
+// The rules of the game: those the databases of the db and approx
+// players were solved with, or else the rules set by flags.
+func playerRules(params Params, players []player) (*farkle.Rules, error) {
+	var dbPaths []string
+	for _, p := range players {
+		if p.spec == "db" {
+			dbPaths = append(dbPaths, params.DBPath)
+		} else if path, ok := strings.CutPrefix(p.spec, "approx:"); ok {
+			dbPaths = append(dbPaths, path)
+		}
+	}
+
+	if len(dbPaths) > 0 {
+		rules, err := farkle.ReadDBRules(dbPaths...)
+		if err != nil {
+			return nil, err
+		}
+		if ruleFlagsSet() {
+			flagRules, err := parseRules(params)
+			if err != nil {
+				return nil, err
+			}
+			if !flagRules.Equal(rules) {
+				return nil, fmt.Errorf("rules set by flags {%v} differ from the rules "+
+					"the databases were solved with {%v}", flagRules, rules)
+			}
+		}
+		return rules, nil
+	}
+	return parseRules(params)
+}
+
+// Names of the flags that set the rules.
+var ruleFlags = []string{
+	"scoring", "score_to_win", "min_opening_score", "farkle_penalty",
+	"score_increment", "score_width", "tie_break",
+}
+
+// Whether any of the rule flags were given.
+func ruleFlagsSet() bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || slices.Contains(ruleFlags, f.Name)
+	})
+	return set
+}
+
+// The rules set by the rule flags.
+func parseRules(params Params) (*farkle.Rules, error) {
+	scoring, err := farkle.ScoringRulesByName(params.Scoring)
+	if err != nil {
+		return nil, err
+	}
+	tieBreak, err := farkle.ParseTieBreak(params.TieBreak)
+	if err != nil {
+		return nil, err
+	}
+	rules := &farkle.Rules{
+		Scoring:         scoring,
+		ScoreToWin:      params.ScoreToWin,
+		MinOpeningScore: params.MinOpening,
+		FarklePenalty:   params.FarklePenalty,
+		ScoreIncrement:  params.ScoreIncrement,
+		ScoreWidth:      params.ScoreWidth,
+		TieBreak:        tieBreak,
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Open the solution database read-only, in the encoding it was written with.
+func openDB(path string, rules *farkle.Rules, numPlayers int) (farkle.PersistentDB, error) {
+	header, err := farkle.ReadDBHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	return farkle.OpenDBReadOnly(path, rules, numPlayers, header.Encoding)
+}
+
+// A player at the table.
+type player struct {
+	name string
+	// "human", or the specification of the computer's strategy.
+	spec     string
+	strategy farkle.Strategy
+}
+
+// Parse the -seats and -names flags. Without seats, a human
+// plays against numPlayers - 1 opponents.
+func parseSeats(seats, names string, numPlayers int, opponent string) ([]player, error) {
+	var specs []string
+	if seats == "" {
+		specs = append(specs, "human")
+		for i := 1; i < numPlayers; i++ {
+			specs = append(specs, "cpu")
+		}
+	} else {
+		specs = strings.Split(seats, ",")
+	}
+	if len(specs) > farkle.MaxNumPlayers {
+		return nil, fmt.Errorf("got %d seats, at most %d players can play", len(specs), farkle.MaxNumPlayers)
+	}
+
+	var nameList []string
+	if names != "" {
+		nameList = strings.Split(names, ",")
+		if len(nameList) != len(specs) {
+			return nil, fmt.Errorf("got %d names for %d seats", len(nameList), len(specs))
+		}
+	}
+
+	players := make([]player, len(specs))
+	for i, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "cpu" {
+			spec = opponent
+		}
+		players[i].spec = spec
+		if nameList != nil {
+			players[i].name = strings.TrimSpace(nameList[i])
+		} else if spec == "human" {
+			players[i].name = fmt.Sprintf("Player %d", i+1)
+		} else {
+			players[i].name = fmt.Sprintf("CPU %d", i+1)
+		}
+	}
+
+	return players, nil
+}
+
+// Record of the game being played, which is also written
+// to a file as it is played if a path is given.
+type recorder struct {
+	game farkle.GameRecord
+	f    *os.File
+	w    *farkle.GameRecordWriter
+}
+
+func newRecorder(path string, header farkle.GameRecordHeader) (*recorder, error) {
+	r := &recorder{game: farkle.GameRecord{Header: header}}
+	if path == "" {
+		return r, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r.f = f
+	r.w = farkle.NewGameRecordWriter(f)
+	if err := r.w.WriteHeader(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *recorder) record(rr farkle.RecordedRoll) {
+	r.game.Rolls = append(r.game.Rolls, rr)
+	if r.w != nil {
+		if err := r.w.WriteRoll(rr); err != nil {
+			glog.Warningf("Error writing game record: %v", err)
+		}
+	}
+}
+
+// Discard all but the first n rolls.
+func (r *recorder) truncate(n int) {
+	r.game.Rolls = r.game.Rolls[:n]
+	if r.w == nil {
+		return
+	}
+
+	err := r.f.Truncate(0)
+	if err == nil {
+		_, err = r.f.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = r.w.WriteGame(r.game)
+	}
+	if err != nil {
+		glog.Warningf("Error rewriting game record: %v", err)
+	}
+}
+
+func (r *recorder) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	return r.f.Close()
 }
 
-func playGame(db farkle.DB, numPlayers int) {
-	state := farkle.NewGameState(numPlayers)
-	humanPlayerID := 0
+// Play a game between the given players. If db is nil,
+// the human players' actions are not evaluated.
+func playGame(rules *farkle.Rules, db farkle.DB, players []player, src farkle.DiceSource, rec *recorder) error {
+	n := len(players)
+	table := farkle.NewTable(n)
+	// Seat of the player whose turn it is, who is always
+	// player 0 at the table.
+	seat := 0
+	fmt.Printf("%s to play first\n\n", players[seat].name)
+	// Decisions made by human players, most recent last, that may be undone.
+	var history []decision
+	// Undoing a decision rewinds the dice, so the game continues
+	// with the same dice as if it had not been undone.
+	dice := farkle.NewRewindableDice(src)
 
-	for !state.IsGameOver() {
-		roll := farkle.NewRandomRoll(int(state.NumDiceToRoll))
-		fmt.Printf("Player %d rolled: %s\n", humanPlayerID, roll)
+	for !table.IsGameOver(rules) {
+		p := players[seat]
+		numDice := dice.Position()
+		roll, err := farkle.RollDice(dice, int(table.NumDiceToRoll))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s rolled: %s\n", p.name, roll)
 		rollID := farkle.GetRollID(roll)
+		var ranked farkle.RankedActions
+		if db != nil {
+			ranked = farkle.RankActions(rules, table.GameState(), rollID, db)
+		}
 
 		var action farkle.Action
-		if farkle.IsFarkle(roll) {
+		if farkle.IsFarkle(rules.Scoring, roll) {
 			fmt.Println("...farkle!")
-		} else if humanPlayerID == 0 {
-			held := promptUserForDiceToKeep(roll)
-			score := state.ScoreThisRound + farkle.CalculateScore(held)
+			if rules.FarklePenalty > 0 {
+				numFarkles := table.ConsecutiveFarkles[0] + 1
+				fmt.Printf("...%d farkle(s) in a row\n", numFarkles)
+				if numFarkles == farkle.NumFarklesForPenalty {
+					fmt.Printf("...penalty of %d points\n", rules.FarklePenalty)
+				}
+			}
+		} else if p.strategy == nil {
+			var options []coachOption
+			for _, ra := range ranked {
+				options = append(options, coachOption{ra.Action,
+					fmt.Sprintf("pWin = %f (%f)", ra.WinProb[0], ra.Delta)})
+			}
+
+			var held farkle.Roll
+			undo := false
+			for {
+				var cmd string
+				held, cmd = promptUserForDiceToKeep(rules, roll)
+				if cmd == "" {
+					break
+				} else if cmd == "undo" && len(history) > 0 {
+					undo = true
+					break
+				} else if cmd == "undo" {
+					fmt.Println("......nothing to undo")
+					continue
+				}
+				coach(cmd, rules, table, roll, options)
+			}
+			if undo {
+				last := history[len(history)-1]
+				history = history[:len(history)-1]
+				table, seat = last.table, last.seat
+				dice.Rewind(last.numDice)
+				rec.truncate(last.numRolls)
+				fmt.Printf("...undid the last decision of %s\n\n", players[seat].name)
+				continue
+			}
+
+			heldID := farkle.GetRollID(held)
+			score := rules.Points(table.ScoreThisRound) + farkle.CalculateScore(rules.Scoring, held)
 			continueRolling := true
-			if state.CurrentPlayerScore() > 0 || score >= 500/50 {
-				fmt.Printf("...score this round = %d\n", int(score)*50)
+			if table.CanStop(rules, heldID) {
+				fmt.Printf("...score this round = %d\n", score)
 				continueRolling = promptUserToContinue()
 			} else {
-				fmt.Printf("...score this round = %d\n", int(score)*50)
-				fmt.Println("...you must continue rolling until you get at least 500")
+				fmt.Printf("...score this round = %d\n", score)
+				fmt.Printf("...you must continue rolling until you get at least %d\n",
+					rules.MinOpeningScore)
 			}
 			action = farkle.Action{
-				HeldDiceID:      farkle.GetRollID(held),
+				HeldDiceID:      heldID,
 				ContinueRolling: continueRolling,
 			}
+			history = append(history, decision{table, seat, numDice, len(rec.game.Rolls)})
 
-			optAction, pWinOpt := farkle.SelectAction(state, rollID, db)
-			pOpt := pWinOpt[0]
-			selectedState := farkle.ApplyAction(state, action)
-			pWinAction := db.Get(selectedState)
-			pAction := pWinAction[0]
-			if !action.ContinueRolling {
-				pAction = pWinAction[numPlayers-1]
+			if db != nil {
+				best := ranked[0]
+				selected, _ := ranked.Find(action)
+				if selected.Delta >= 0 {
+					fmt.Printf("...selected action is optimal! (pWin = %f)\n", selected.WinProb[0])
+				} else {
+					fmt.Printf("...optimal action was %s with pWin = %f\n",
+						best.Action, best.WinProb[0])
+					fmt.Printf("...selected action has pWin = %f (%f)\n",
+						selected.WinProb[0], selected.Delta)
+				}
 			}
-			if pAction >= pOpt {
-				fmt.Printf("...selected action is optimal! (pWin = %f)\n", pAction)
+		} else { // CP
+			fmt.Printf("...score this round = %d\n", rules.Points(table.ScoreThisRound))
+			action = p.strategy.ChooseAction(table, roll)
+			if db != nil {
+				selected, _ := ranked.Find(action)
+				fmt.Printf("...selected action %s (pWin = %f)\n", action, selected.WinProb[0])
 			} else {
-				fmt.Printf("...optimal action was %s with pWin = %f\n",
-					optAction, pOpt)
-				fmt.Printf("...selected action has pWin = %f (%f)\n",
-					pAction, pAction-pOpt)
+				fmt.Printf("...selected action %s\n", action)
 			}
-		} else { // CP
-			fmt.Printf("...score this round = %d\n", int(state.ScoreThisRound)*50)
-			selected, pWin := farkle.SelectAction(state, rollID, db)
-			fmt.Printf("...selected action %s (pWin = %f)\n", selected, pWin[0])
-			action = selected
-			fmt.Scanln()
+			readLine()
+		}
+
+		rr := farkle.NewRecordedRoll(rules, table, seat, roll, action)
+		if db != nil {
+			rr.Eval = ranked.Evaluate(action)
 		}
+		rec.record(rr)
 
-		state = farkle.ApplyAction(state, action)
+		table = farkle.ApplyTableAction(rules, table, action)
 		if !action.ContinueRolling {
-			humanPlayerID--
-			if humanPlayerID < 0 {
-				humanPlayerID = numPlayers - 1
-			}
-			playerScore := int(state.PlayerScores[humanPlayerID]) * 50
-			otherScores := make([]int, 0, state.NumPlayers-1)
-			for player, score := range state.PlayerScores[:state.NumPlayers] {
-				if player == humanPlayerID {
+			seat = (seat + 1) % n
+			printScoreboard(rules, players, table, seat)
+		}
+	}
+
+	scores := seatScores(rules, table, seat)
+	highestScore := rules.Points(table.HighestScore())
+	var winners []string
+	for i, score := range scores {
+		if score == highestScore {
+			winners = append(winners, players[i].name)
+		}
+	}
+	if len(winners) == 1 {
+		fmt.Printf("%s wins with %d points!\n", winners[0], highestScore)
+	} else {
+		outcome := "split the win"
+		switch rules.TieBreak {
+		case farkle.TiesLose:
+			outcome = "all lose"
+		case farkle.TiesWin:
+			outcome = "all win"
+		case farkle.SuddenDeath:
+			// The sudden-death round is not played out.
+			outcome = "share the win by their chance in a sudden-death round"
+		}
+		fmt.Printf("%s tie with %d points, and %s\n",
+			strings.Join(winners, " and "), highestScore, outcome)
+	}
+
+	if db != nil {
+		fmt.Println()
+		analysis := farkle.NewBlunderAnalysis(rules, db)
+		if err := analysis.AddGame(rec.game); err != nil {
+			glog.Errorf("Unable to analyze game: %v", err)
+			return nil
+		}
+		analysis.WriteReport(os.Stdout, 5)
+	}
+	return nil
+}
+
+// Banked score of each seat in points, given the seat whose turn it is.
+func seatScores(rules *farkle.Rules, table farkle.Table, seat int) []int {
+	n := int(table.NumPlayers)
+	scores := make([]int, n)
+	for i, score := range table.PlayerScores[:n] {
+		scores[(seat+i)%n] = rules.Points(score)
+	}
+	return scores
+}
+
+func printScoreboard(rules *farkle.Rules, players []player, table farkle.Table, seat int) {
+	fmt.Println("Scores:")
+	for i, score := range seatScores(rules, table, seat) {
+		next := ""
+		if i == seat && !table.IsGameOver(rules) {
+			next = "  <- next to play"
+		}
+		fmt.Printf("  %-20s %6d%s\n", players[i].name, score, next)
+	}
+	if !table.IsGameOver(rules) && rules.Points(table.HighestScore()) >= rules.ScoreToWin {
+		fmt.Println("Final round!")
+	}
+	fmt.Println()
+}
+
+// Play alone until reaching the score to win, grading each action
+// by the expected points banked in the turn.
+func playSolitaire(rules *farkle.Rules, table *farkle.SolitaireTable, dice farkle.DiceSource,
+	rec *recorder) error {
+	state := farkle.NewGameState(1)
+	numTurns := 0
+	totalLoss := 0.0
+	fmt.Printf("Expected number of turns to reach %d: %.2f\n\n",
+		rules.ScoreToWin, table.ExpectedTurns(state))
+
+	for !state.IsGameOver(rules) {
+		roll, err := farkle.RollDice(dice, int(state.NumDiceToRoll))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Turn %d, you rolled: %s\n", numTurns+1, roll)
+
+		var action farkle.Action
+		if farkle.IsFarkle(rules.Scoring, roll) {
+			fmt.Println("...farkle!")
+		} else {
+			ranked := table.RankActions(state, roll)
+			var options []coachOption
+			for _, sa := range ranked {
+				options = append(options, coachOption{sa.Action,
+					fmt.Sprintf("expected points = %.1f (%.1f)", sa.ExpectedPoints, sa.Delta)})
+			}
+
+			var held farkle.Roll
+			for {
+				var cmd string
+				held, cmd = promptUserForDiceToKeep(rules, roll)
+				if cmd == "" {
+					break
+				} else if cmd == "undo" {
+					fmt.Println("......undo is not available in solitaire mode")
 					continue
 				}
+				coach(cmd, rules, state.Table(), roll, options)
+			}
 
-				otherScores = append(otherScores, 50*int(score))
+			heldID := farkle.GetRollID(held)
+			score := rules.Points(state.ScoreThisRound) + farkle.CalculateScore(rules.Scoring, held)
+			fmt.Printf("...score this round = %d\n", score)
+			continueRolling := true
+			if rules.CanStop(state, heldID) {
+				continueRolling = promptUserToContinue()
+			} else {
+				fmt.Printf("...you must continue rolling until you get at least %d\n",
+					rules.MinOpeningScore)
+			}
+			action = farkle.Action{
+				HeldDiceID:      heldID,
+				ContinueRolling: continueRolling,
+			}
+
+			best := ranked[0]
+			selected, _ := ranked.Find(action)
+			if selected.Delta >= 0 {
+				fmt.Printf("...selected action is optimal! (expected points = %.1f)\n",
+					selected.ExpectedPoints)
+			} else {
+				fmt.Printf("...optimal action was %s with expected points = %.1f\n",
+					best.Action, best.ExpectedPoints)
+				fmt.Printf("...selected action has expected points = %.1f (%.1f)\n",
+					selected.ExpectedPoints, selected.Delta)
+				totalLoss -= selected.Delta
 			}
-			fmt.Printf("Current scores: player = %d, others: %v\n\n",
-				playerScore, otherScores)
+		}
+
+		rec.record(farkle.NewRecordedRoll(rules, state.Table(), 0, roll, action))
+		state = farkle.ApplyAction(rules, state, action)
+		if !action.ContinueRolling {
+			numTurns++
+			fmt.Printf("Score after %d turns: %d, expected turns remaining: %.2f\n\n",
+				numTurns, rules.Points(state.PlayerScores[0]), table.ExpectedTurns(state))
 		}
 	}
 
-	if state.PlayerScores[humanPlayerID] == state.HighestScore() {
-		fmt.Println("You win!")
-	} else {
-		fmt.Println("You lose!")
+	fmt.Printf("Reached %d in %d turns, losing %.1f expected points to suboptimal actions\n",
+		rules.Points(state.PlayerScores[0]), numTurns, totalLoss)
+	return nil
+}
+
+// A human player's decision, and what is needed to take it back.
+type decision struct {
+	table farkle.Table
+	seat  int
+	// Number of dice rolled before the roll that was decided on.
+	numDice int
+	// Number of rolls recorded before the decision.
+	numRolls int
+}
+
+// Commands that may be entered instead of the dice to keep.
+var coachingCommands = []string{"help", "hint", "odds", "undo", "why"}
+
+// An action the player may take, and its value.
+type coachOption struct {
+	action farkle.Action
+	value  string
+}
+
+// Answer one of the coachingCommands, other than undo. The legal actions
+// are ranked best first, or nil if there is nothing to rank them with.
+func coach(cmd string, rules *farkle.Rules, table farkle.Table, roll farkle.Roll, options []coachOption) {
+	switch cmd {
+	case "help":
+		fmt.Println("......hint: show the best action")
+		fmt.Println("......why:  show the three best actions")
+		fmt.Println("......odds: show the chance of farkling with the dice left after each hold")
+		fmt.Println("......undo: take back the last decision")
+	case "hint", "why":
+		if options == nil {
+			fmt.Println("......no database to rank actions with")
+			return
+		}
+		n := 1
+		if cmd == "why" {
+			n = 3
+		}
+		for i, opt := range options[:min(n, len(options))] {
+			fmt.Printf("......%d. %s: %s\n", i+1, opt.action, opt.value)
+		}
+	case "odds":
+		for _, hold := range farkle.ValidHolds(rules.Scoring, roll) {
+			score := rules.Points(table.ScoreThisRound) + farkle.CalculateScore(rules.Scoring, hold)
+			numDice := int(roll.NumDice() - hold.NumDice())
+			if numDice == 0 {
+				numDice = farkle.MaxNumDice
+			}
+			odds := farkle.CalcRollOdds(rules, numDice)
+			expected := (1-odds.PFarkle)*float64(score) + odds.ExpectedScore
+			fmt.Printf("......hold %v for %d: rolling %d dice farkles %.1f%% of the time, expected %.0f after the roll\n",
+				hold, score, numDice, 100*odds.PFarkle, expected)
+		}
 	}
 }
 
-func promptUserForDiceToKeep(roll farkle.Roll) farkle.Roll {
+// Shared by all prompts, so that no buffered input is lost between them.
+var stdin = bufio.NewReader(os.Stdin)
+
+// Read a line of input, exiting the game at the end of input.
+func readLine() string {
+	line, err := stdin.ReadString('\n')
+	if err == io.EOF && line == "" {
+		fmt.Println()
+		os.Exit(0)
+	} else if err != nil && err != io.EOF {
+		glog.Errorf("Unable to read input: %v", err)
+		os.Exit(1)
+	}
+	return strings.TrimSpace(line)
+}
+
+// Prompt for the dice to keep, or one of the coachingCommands,
+// which is returned instead.
+func promptUserForDiceToKeep(rules *farkle.Rules, roll farkle.Roll) (farkle.Roll, string) {
 	var held farkle.Roll
 	for {
-		fmt.Printf("...enter dice to keep: ")
-		rdr := bufio.NewReader(os.Stdin)
-		toKeepStr, err := rdr.ReadString('\n')
-		if err != nil {
-			fmt.Printf("......unable to read dice: %v\n", err)
-			continue
+		fmt.Printf("...enter dice to keep (or help): ")
+		toKeepStr := readLine()
+		if cmd := strings.ToLower(toKeepStr); slices.Contains(coachingCommands, cmd) {
+			return farkle.Roll{}, cmd
 		}
 
+		var err error
 		held, err = parseHeld(toKeepStr)
 		if err == nil {
-			if !farkle.IsValidHold(roll, held) {
+			if !farkle.IsValidHold(rules.Scoring, roll, held) {
 				err = fmt.Errorf("can't hold %v, not a valid trick", held)
 			}
 
 			if err == nil {
-				return held
+				return held, ""
 			}
 		}
 
@@ -152,10 +766,7 @@ var yesNoResponses = map[string]bool{
 func promptUserToContinue() bool {
 	for {
 		fmt.Printf("...continue rolling (Y/N)? ")
-		var yesNoStr string
-		fmt.Scanln(&yesNoStr)
-
-		yesNoStr = strings.ToUpper(strings.TrimSpace(yesNoStr))
+		yesNoStr := strings.ToUpper(readLine())
 		continueRolling, ok := yesNoResponses[yesNoStr]
 		if !ok {
 			fmt.Printf("......don't understand '%s'\n", yesNoStr)
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/timpalpant/go-farkle"
+)
+
+type Params struct {
+	Strategies     string
+	NumGames       int
+	Seed           int64
+	Dice           string
+	RecordPath     string
+	Scoring        string
+	ScoreToWin     int
+	MinOpening     int
+	FarklePenalty  int
+	ScoreIncrement int
+	ScoreWidth     int
+	TieBreak       string
+}
+
+func main() {
+	var params Params
+	flag.StringVar(&params.Strategies, "strategies", "db:2player.db,db:2player.db",
+		"Comma-separated strategy of each player, one of: db:<path to solution database>, "+
+			"approx:<path to approximate solution>, "+
+			strings.Join(farkle.HeuristicStrategyUsage, ", "))
+	flag.IntVar(&params.NumGames, "num_games", 10000, "Number of games to play")
+	flag.Int64Var(&params.Seed, "seed", 12345, "Random seed")
+	flag.StringVar(&params.Dice, "dice", "seed",
+		"Source of dice rolls, one of: seed[:<seed>] (seeded per game), crypto, "+
+			"or file:<path>[@<position>] (games are played one at a time, continuing the script)")
+	flag.StringVar(&params.RecordPath, "record", "",
+		"If set, write a record of every game to this JSON Lines file")
+	flag.StringVar(&params.Scoring, "scoring", farkle.StandardScoring.Name,
+		"Scoring rules, one of: "+strings.Join(farkle.ScoringRulesNames(), ", ")+
+			". This and the other rule flags are only needed without db or approx strategies, "+
+			"which play by the rules their database was solved with")
+	flag.IntVar(&params.ScoreToWin, "score_to_win", farkle.DefaultRules.ScoreToWin,
+		"Score that triggers the final round")
+	flag.IntVar(&params.MinOpening, "min_opening_score", farkle.DefaultRules.MinOpeningScore,
+		"Minimum score in a single turn to get on the board")
+	flag.IntVar(&params.FarklePenalty, "farkle_penalty", 0,
+		"Points deducted after three farkles in a row (0 to disable)")
+	flag.IntVar(&params.ScoreIncrement, "score_increment", farkle.DefaultScoreIncrement,
+		"Points that all scores are multiples of")
+	flag.IntVar(&params.ScoreWidth, "score_width", farkle.DefaultScoreWidth,
+		"Bytes used to store each score (1 or 2)")
+	flag.StringVar(&params.TieBreak, "tie_break", farkle.SplitTies.String(),
+		"How a tie for the highest score is valued: split, loss, win or sudden_death. "+
+			"sudden_death is approximate: the extra round is not played out, and each tied "+
+			"player gets their expected share of the win, where only the first player's "+
+			"chance is solved, the others split the rest evenly, and the farkle penalty is ignored")
+	flag.Parse()
+
+	specs := strings.Split(params.Strategies, ",")
+	numPlayers := len(specs)
+	if numPlayers > farkle.MaxNumPlayers {
+		glog.Errorf("Got %d strategies, at most %d players can play", numPlayers, farkle.MaxNumPlayers)
+		os.Exit(1)
+	}
+	rules, err := strategyRules(params, specs)
+	if err != nil {
+		glog.Errorf("Invalid rules: %v", err)
+		os.Exit(1)
+	}
+	strategies := make([]farkle.Strategy, numPlayers)
+	for i, spec := range specs {
+		strategy, closer, err := newStrategy(spec, rules, numPlayers)
+		if err != nil {
+			glog.Errorf("Invalid strategy %q: %v", spec, err)
+			os.Exit(1)
+		}
+		if closer != nil {
+			defer closer.Close()
+		}
+		strategies[i] = strategy
+	}
+
+	newDice, sequential, err := newDiceFactory(params.Dice, params.Seed)
+	if err != nil {
+		glog.Errorf("Invalid dice source: %v", err)
+		os.Exit(1)
+	}
+	numWorkers := runtime.NumCPU()
+	if sequential {
+		numWorkers = 1
+	}
+
+	record := params.RecordPath != ""
+	results, err := simulate(rules, strategies, params.NumGames, numWorkers, newDice, record)
+	if err != nil {
+		glog.Errorf("Error playing games: %v", err)
+		os.Exit(1)
+	}
+	if record {
+		if err := writeRecords(params.RecordPath, rules, specs, results); err != nil {
+			glog.Errorf("Error writing game records: %v", err)
+			os.Exit(1)
+		}
+	}
+	report(specs, results)
+}
+
+// The rules the strategies play by: those the databases of the db and
+// approx strategies were solved with, or else the rules set by flags.
+func strategyRules(params Params, specs []string) (*farkle.Rules, error) {
+	var dbPaths []string
+	for _, spec := range specs {
+		if kind, path, _ := strings.Cut(spec, ":"); kind == "db" || kind == "approx" {
+			dbPaths = append(dbPaths, path)
+		}
+	}
+
+	if len(dbPaths) > 0 {
+		rules, err := farkle.ReadDBRules(dbPaths...)
+		if err != nil {
+			return nil, err
+		}
+		if ruleFlagsSet() {
+			flagRules, err := parseRules(params)
+			if err != nil {
+				return nil, err
+			}
+			if !flagRules.Equal(rules) {
+				return nil, fmt.Errorf("rules set by flags {%v} differ from the rules "+
+					"the databases were solved with {%v}", flagRules, rules)
+			}
+		}
+		return rules, nil
+	}
+	return parseRules(params)
+}
+
+// Names of the flags that set the rules.
+var ruleFlags = []string{
+	"scoring", "score_to_win", "min_opening_score", "farkle_penalty",
+	"score_increment", "score_width", "tie_break",
+}
+
+// Whether any of the rule flags were given.
+func ruleFlagsSet() bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || slices.Contains(ruleFlags, f.Name)
+	})
+	return set
+}
+
+// The rules set by the rule flags.
+func parseRules(params Params) (*farkle.Rules, error) {
+	scoring, err := farkle.ScoringRulesByName(params.Scoring)
+	if err != nil {
+		return nil, err
+	}
+	tieBreak, err := farkle.ParseTieBreak(params.TieBreak)
+	if err != nil {
+		return nil, err
+	}
+	rules := &farkle.Rules{
+		Scoring:         scoring,
+		ScoreToWin:      params.ScoreToWin,
+		MinOpeningScore: params.MinOpening,
+		FarklePenalty:   params.FarklePenalty,
+		ScoreIncrement:  params.ScoreIncrement,
+		ScoreWidth:      params.ScoreWidth,
+		TieBreak:        tieBreak,
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Create the strategy with the given specification, and anything
+// that must be closed once it is no longer needed.
+func newStrategy(spec string, rules *farkle.Rules, numPlayers int) (farkle.Strategy, io.Closer, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "db":
+		header, err := farkle.ReadDBHeader(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		db, err := farkle.OpenDBReadOnly(arg, rules, numPlayers, header.Encoding)
+		if err != nil {
+			return nil, nil, err
+		}
+		return farkle.NewDBStrategy(rules, db), db, nil
+	case "approx":
+		db, err := farkle.OpenApproxDB(arg, rules, numPlayers)
+		if err != nil {
+			return nil, nil, err
+		}
+		return farkle.NewApproxStrategy(db), db, nil
+	default:
+		strategy, err := farkle.NewHeuristicStrategy(rules, spec)
+		return strategy, nil, err
+	}
+}
+
+// Create a function returning the dice for each deal, and the
+// specification that reproduces them. With a seeded source, each deal
+// is seeded separately so the results do not depend on the order in
+// which games are played. A script is shared by all games, which must
+// then be played one at a time, in order.
+func newDiceFactory(spec string, defaultSeed int64) (newDice func(deal int) (farkle.DiceSource, string), sequential bool, err error) {
+	kind, arg, hasArg := strings.Cut(spec, ":")
+	switch kind {
+	case "seed":
+		seed := defaultSeed
+		if hasArg {
+			var err error
+			seed, err = strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid seed: %w", err)
+			}
+		}
+		return func(deal int) (farkle.DiceSource, string) {
+			return farkle.NewSeededDice(seed + int64(deal)), fmt.Sprintf("seed:%d", seed+int64(deal))
+		}, false, nil
+	case "file":
+		src, err := farkle.ParseDiceSource(spec, defaultSeed)
+		if err != nil {
+			return nil, false, err
+		}
+		// Each game is recorded as starting where the last one stopped.
+		dice := src.(*farkle.ScriptedDice)
+		return func(deal int) (farkle.DiceSource, string) {
+			return dice, dice.Spec()
+		}, true, nil
+	default:
+		// A crypto source is shared by all games.
+		dice, err := farkle.ParseDiceSource(spec, defaultSeed)
+		if err != nil {
+			return nil, false, err
+		}
+		return func(deal int) (farkle.DiceSource, string) {
+			return dice, spec
+		}, false, nil
+	}
+}
+
+// Result of a simulated game, with one entry per strategy
+// (rather than per seat).
+type result struct {
+	farkle.GameResult
+	// Seat of each strategy.
+	Seats []int
+	// Dice source of the game, and every roll if recorded.
+	Dice  string
+	Rolls []farkle.RecordedRoll
+}
+
+// Play numGames games, rotating the strategies through all seat orders.
+// Consecutive games in each rotation are dealt the same dice, so that
+// differences between the strategies are not due to luck of the dice,
+// unless the dice source is shared by all games.
+func simulate(rules *farkle.Rules, strategies []farkle.Strategy, numGames, numWorkers int,
+	newDice func(deal int) (farkle.DiceSource, string), record bool) ([]result, error) {
+	orders := permutations(len(strategies))
+	results := make([]result, numGames)
+	errs := make([]error, numGames)
+	gameCh := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			seated := make([]farkle.Strategy, len(strategies))
+			for game := range gameCh {
+				order := orders[game%len(orders)]
+				for strategy, seat := range order {
+					seated[seat] = strategies[strategy]
+				}
+
+				dice, diceSpec := newDice(game / len(orders))
+				r := result{Seats: order, Dice: diceSpec}
+				if record {
+					r.GameResult, r.Rolls, errs[game] = farkle.PlayRecordedGame(rules, seated, dice)
+				} else {
+					r.GameResult, errs[game] = farkle.PlayGame(rules, seated, dice)
+				}
+				results[game] = r
+			}
+		}()
+	}
+
+	for game := 0; game < numGames; game++ {
+		if game%1000 == 0 {
+			glog.Infof("Playing game %d", game)
+		}
+		gameCh <- game
+	}
+	close(gameCh)
+	wg.Wait()
+
+	for game, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("game %d: %w", game, err)
+		}
+	}
+	return results, nil
+}
+
+// Write every game as a JSON Lines game record.
+func writeRecords(path string, rules *farkle.Rules, specs []string, results []result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	rw := farkle.NewGameRecordWriter(w)
+	for _, r := range results {
+		players := make([]string, len(specs))
+		for strategy, seat := range r.Seats {
+			players[seat] = specs[strategy]
+		}
+		err := rw.WriteGame(farkle.GameRecord{
+			Header: farkle.GameRecordHeader{
+				Rules:      rules,
+				NumPlayers: len(specs),
+				Dice:       r.Dice,
+				Players:    players,
+			},
+			Rolls: r.Rolls,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// All orderings of n seats. Each ordering maps strategy index to seat.
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+
+	var result [][]int
+	for _, perm := range permutations(n - 1) {
+		for pos := 0; pos <= len(perm); pos++ {
+			newPerm := make([]int, 0, n)
+			newPerm = append(newPerm, perm[:pos]...)
+			newPerm = append(newPerm, n-1)
+			newPerm = append(newPerm, perm[pos:]...)
+			result = append(result, newPerm)
+		}
+	}
+	return result
+}
+
+func report(names []string, results []result) {
+	n := len(names)
+	wins := make([]float64, n)
+	points := make([]int, n)
+	turns := make([]int, n)
+	totalTurns := 0
+	for _, r := range results {
+		for strategy, seat := range r.Seats {
+			wins[strategy] += r.Wins[seat]
+			points[strategy] += r.Scores[seat]
+			turns[strategy] += r.NumTurns[seat]
+			totalTurns += r.NumTurns[seat]
+		}
+	}
+
+	numGames := float64(len(results))
+	fmt.Printf("Played %d games\n", len(results))
+	fmt.Printf("Average game length: %.1f turns\n", float64(totalTurns)/numGames)
+	fmt.Printf("%-3s %-30s %-22s %s\n", "", "Strategy", "Win rate (95% CI)", "Points/turn")
+	for i, name := range names {
+		p := wins[i] / numGames
+		ci := 1.96 * math.Sqrt(p*(1-p)/numGames)
+		fmt.Printf("%-3d %-30s %.4f ± %.4f        %.1f\n",
+			i, name, p, ci, float64(points[i])/float64(turns[i]))
+	}
+}
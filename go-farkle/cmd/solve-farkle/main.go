@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/timpalpant/go-farkle"
@@ -16,48 +21,261 @@ type Params struct {
 	GameStatesPath string
 	DBPath         string
 	NumIter        int
+	Tolerance      float64
+	Scoring        string
+	ScoreToWin     int
+	MinOpening     int
+	FarklePenalty  int
+	ScoreIncrement int
+	ScoreWidth     int
+	TieBreak       string
+	DBEncoding     string
+	Resume         bool
+	CheckpointFreq time.Duration
+	Mode           string
+	Opponent       string
 }
 
 func main() {
 	var params Params
 	flag.IntVar(&params.NumPlayers, "num_players", 2, "Number of players")
-	flag.StringVar(&params.GameStatesPath, "games", "2player.games", "Path to sorted game states")
+	flag.StringVar(&params.GameStatesPath, "games", "2player.games",
+		"Path to sorted game states, which are enumerated if the file does not exist. "+
+			"The file is only valid for the rules and number of players it was enumerated for")
 	flag.StringVar(&params.DBPath, "db", "2player.db", "Path to solution database")
-	flag.IntVar(&params.NumIter, "num_iter", 10, "Number of value iteration cycles")
+	flag.IntVar(&params.NumIter, "num_iter", 10, "Maximum number of value iteration cycles")
+	flag.Float64Var(&params.Tolerance, "tolerance", 1e-6,
+		"Stop when the largest change in any win probability is below this")
+	flag.StringVar(&params.Scoring, "scoring", farkle.StandardScoring.Name,
+		"Scoring rules, one of: "+strings.Join(farkle.ScoringRulesNames(), ", "))
+	flag.IntVar(&params.ScoreToWin, "score_to_win", farkle.DefaultRules.ScoreToWin,
+		"Score that triggers the final round")
+	flag.IntVar(&params.MinOpening, "min_opening_score", farkle.DefaultRules.MinOpeningScore,
+		"Minimum score in a single turn to get on the board")
+	flag.IntVar(&params.FarklePenalty, "farkle_penalty", 0,
+		"Points deducted after three farkles in a row (0 to disable)")
+	flag.IntVar(&params.ScoreIncrement, "score_increment", farkle.DefaultScoreIncrement,
+		"Points that all scores are multiples of")
+	flag.IntVar(&params.ScoreWidth, "score_width", farkle.DefaultScoreWidth,
+		"Bytes used to store each score (1 or 2)")
+	flag.StringVar(&params.TieBreak, "tie_break", farkle.SplitTies.String(),
+		"How a tie for the highest score is valued: split, loss, win or sudden_death. "+
+			"sudden_death is approximate: only the first tied player's chance of winning "+
+			"the extra round is solved, the others split the rest evenly, and the farkle "+
+			"penalty is ignored in that round")
+	flag.BoolVar(&params.Resume, "resume", false,
+		"Resume an interrupted value iteration cycle from the database's checkpoint")
+	flag.DurationVar(&params.CheckpointFreq, "checkpoint_interval", 10*time.Minute,
+		"How often to flush the database and save a checkpoint")
+	flag.StringVar(&params.DBEncoding, "db_encoding", farkle.Float64Encoding.String(),
+		"Encoding of win probabilities in the database: float64, float32, uint32 or uint16")
+	flag.StringVar(&params.Mode, "mode", "win",
+		"win to maximize the probability of winning, approx to do so approximately "+
+			"for up to 8 players, or solitaire to write a table of "+
+			"the expected points banked in a turn as CSV to stdout")
+	flag.StringVar(&params.Opponent, "opponent", "greedy",
+		"With -mode approx, the heuristic strategy opponents are modeled with, one of: "+
+			strings.Join(farkle.HeuristicStrategyUsage, ", "))
 	flag.Parse()
 
+	scoring, err := farkle.ScoringRulesByName(params.Scoring)
+	if err != nil {
+		glog.Errorf("Invalid scoring rules: %v", err)
+		os.Exit(1)
+	}
+	tieBreak, err := farkle.ParseTieBreak(params.TieBreak)
+	if err != nil {
+		glog.Errorf("Invalid tie-break policy: %v", err)
+		os.Exit(1)
+	}
+	rules := &farkle.Rules{
+		Scoring:         scoring,
+		ScoreToWin:      params.ScoreToWin,
+		MinOpeningScore: params.MinOpening,
+		FarklePenalty:   params.FarklePenalty,
+		ScoreIncrement:  params.ScoreIncrement,
+		ScoreWidth:      params.ScoreWidth,
+		TieBreak:        tieBreak,
+	}
+	if err := rules.Validate(); err != nil {
+		glog.Errorf("Invalid rules: %v", err)
+		os.Exit(1)
+	}
+	glog.Infof("Rules: %v", rules)
+
+	if params.Mode == "solitaire" {
+		table := farkle.NewSolitaireTable(rules)
+		if err := table.WriteCSV(os.Stdout); err != nil {
+			glog.Errorf("Error writing table: %v", err)
+			os.Exit(1)
+		}
+		return
+	} else if params.Mode == "approx" {
+		solveApprox(params, rules)
+		return
+	} else if params.Mode != "win" {
+		glog.Errorf("Invalid mode: %q", params.Mode)
+		os.Exit(1)
+	}
+
 	go http.ListenAndServe(":6069", nil)
 
-	initialState := farkle.NewGameState(params.NumPlayers)
-	glog.Infof("Initial state: %v", initialState)
+	encoding, err := farkle.ParseValueEncoding(params.DBEncoding)
+	if err != nil {
+		glog.Errorf("Invalid database encoding: %v", err)
+		os.Exit(1)
+	}
 
-	db, err := farkle.NewFileDB(params.DBPath, params.NumPlayers)
+	db, err := farkle.OpenDB(params.DBPath, rules, params.NumPlayers, encoding)
 	if err != nil {
 		glog.Errorf("Unable to open database: %v", err)
 		os.Exit(1)
 	}
 
+	initialState := farkle.NewGameState(params.NumPlayers)
+	glog.Infof("Initial state: %s", rules.FormatState(initialState))
+
 	if _, err := os.Stat(params.GameStatesPath); err != nil {
 		glog.Infof("Enumerating and sorting game states by depth")
-		gamesIter := farkle.SortedGameStates(params.NumPlayers, filepath.Dir(params.GameStatesPath))
-		if err := farkle.SaveGameStates(gamesIter, params.GameStatesPath); err != nil {
+		gamesIter := farkle.SortedGameStates(rules, params.NumPlayers, filepath.Dir(params.GameStatesPath))
+		if err := farkle.SaveGameStates(rules, params.NumPlayers, gamesIter, params.GameStatesPath); err != nil {
 			glog.Errorf("Error sorting game state: %v", err)
 			os.Exit(1)
 		}
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	checkpointPath := farkle.CheckpointPath(params.DBPath)
+	var checkpoint farkle.Checkpoint
+	if params.Resume {
+		checkpoint, err = farkle.LoadCheckpoint(checkpointPath)
+		if err != nil {
+			glog.Errorf("Unable to load checkpoint: %v", err)
+			closeDB(db)
+			os.Exit(1)
+		}
+		if checkpoint.NumIterations != db.Header().NumIterations {
+			glog.Errorf("Checkpoint is for iteration %d, but database has completed %d",
+				checkpoint.NumIterations, db.Header().NumIterations)
+			closeDB(db)
+			os.Exit(1)
+		}
+		if checkpoint.InProgress {
+			glog.Infof("Resuming value iteration cycle %d after depth %d",
+				checkpoint.NumIterations, checkpoint.LastCompletedDepth)
+		}
+	} else {
+		// An interrupted cycle is started over, but the residuals of
+		// the cycles the database has completed are kept.
+		checkpoint = farkle.Checkpoint{NumIterations: db.Header().NumIterations}
+		if prev, err := farkle.LoadCheckpoint(checkpointPath); err != nil {
+			glog.Warningf("Unable to load checkpoint, the residuals of earlier cycles are lost: %v", err)
+		} else if prev.NumIterations == checkpoint.NumIterations {
+			checkpoint.Residuals = prev.Residuals
+		}
+	}
+
 	for i := 0; i < params.NumIter; i++ {
-		glog.Infof("Starting value iteration cycle %d", i)
-		gamesIter, err := farkle.IterGameStates(params.NumPlayers, params.GameStatesPath)
+		iteration := db.Header().NumIterations
+		glog.Infof("Starting value iteration cycle %d", iteration)
+		gamesIter, err := farkle.IterGameStates(rules, params.NumPlayers, params.GameStatesPath)
 		if err != nil {
-			glog.Errorf("Error loading sorted game states: %v", err)
+			glog.Errorf("Error loading sorted game states, remove %s to enumerate them again: %v",
+				params.GameStatesPath, err)
+			closeDB(db)
 			os.Exit(1)
 		}
-		farkle.UpdateAll(db, gamesIter)
+
+		resumedStats := farkle.UpdateStats{}
+		if checkpoint.InProgress {
+			gamesIter = checkpoint.SkipCompleted(gamesIter)
+			resumedStats = checkpoint.Stats
+		}
+
+		lastCheckpoint := time.Now()
+		stats, err := farkle.UpdateAll(ctx, rules, db, gamesIter, func(depth uint16, stats farkle.UpdateStats) error {
+			checkpoint.InProgress = true
+			checkpoint.LastCompletedDepth = depth
+			checkpoint.Stats = stats
+			checkpoint.Stats.Add(resumedStats)
+			if time.Since(lastCheckpoint) < params.CheckpointFreq {
+				return nil
+			}
+
+			lastCheckpoint = time.Now()
+			return saveCheckpoint(db, checkpoint, checkpointPath)
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				glog.Infof("Interrupted, saving checkpoint after depth %d", checkpoint.LastCompletedDepth)
+			} else {
+				glog.Errorf("Error updating game states: %v", err)
+			}
+			if err := saveCheckpoint(db, checkpoint, checkpointPath); err != nil {
+				glog.Errorf("Error saving checkpoint: %v", err)
+			}
+			closeDB(db)
+			os.Exit(1)
+		}
+
+		stats.Add(resumedStats)
+		glog.Infof("Completed value iteration cycle %d: %v", iteration, stats)
 		winProb := db.Get(initialState)
 		glog.Infof("Probability of winning: %v", winProb)
+
+		if err := db.RecordIteration(stats.MaxResidual); err != nil {
+			glog.Errorf("Error recording iteration: %v", err)
+			os.Exit(1)
+		}
+		checkpoint = farkle.Checkpoint{
+			NumIterations: db.Header().NumIterations,
+			Residuals:     append(checkpoint.Residuals, stats.MaxResidual),
+		}
+		if err := saveCheckpoint(db, checkpoint, checkpointPath); err != nil {
+			glog.Errorf("Error saving checkpoint: %v", err)
+			os.Exit(1)
+		}
+
+		if stats.MaxResidual < params.Tolerance {
+			glog.Infof("Converged after %d cycles: max residual %g < tolerance %g",
+				iteration+1, stats.MaxResidual, params.Tolerance)
+			break
+		}
+	}
+
+	closeDB(db)
+}
+
+// Solve approximately and save the solution to the database path.
+func solveApprox(params Params, rules *farkle.Rules) {
+	db, err := farkle.SolveApprox(rules, params.NumPlayers, params.Opponent)
+	if err != nil {
+		glog.Errorf("Unable to solve: %v", err)
+		os.Exit(1)
 	}
+	initialTable := farkle.NewTable(params.NumPlayers)
+	glog.Infof("Probability of winning for the first player: %v", db.WinProb(initialTable))
+
+	if err := db.Save(params.DBPath); err != nil {
+		glog.Errorf("Error saving solution: %v", err)
+		os.Exit(1)
+	}
+}
+
+// Flush the database to disk so that it is consistent with the checkpoint.
+func saveCheckpoint(db farkle.PersistentDB, checkpoint farkle.Checkpoint, path string) error {
+	if err := db.Sync(); err != nil {
+		return err
+	}
+
+	glog.Infof("Saving checkpoint: iteration %d, in progress = %v, last completed depth = %d",
+		checkpoint.NumIterations, checkpoint.InProgress, checkpoint.LastCompletedDepth)
+	return checkpoint.Save(path)
+}
 
+func closeDB(db farkle.PersistentDB) {
 	if err := db.Close(); err != nil {
 		glog.Errorf("Error closing database: %v", err)
 		os.Exit(1)
@@ -5,9 +5,11 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"math"
 	"os"
+	"sync/atomic"
 
 	"github.com/golang/glog"
 	"golang.org/x/sys/unix"
@@ -23,77 +25,309 @@ type DB interface {
 	io.Closer
 }
 
+// ConcurrentDB is a DB whose Put and Get may be called concurrently,
+// including for the same game state, without any external locking.
+// A Get that races with a Put may return a mix of old and new win
+// probabilities, but never a partially written probability.
+type ConcurrentDB interface {
+	DB
+	concurrent()
+}
+
 // DB that stores results in a memory-mapped flat file.
+// The file starts with a DBHeader, followed by numPlayers
+// float64 values for each game state, ordered by game state ID.
 type FileDB struct {
+	*mappedFile
 	numPlayers int
-	f          *os.File
+	nPuts      atomic.Int64
+}
 
-	mmap  []byte
-	nPuts int64
+func NewFileDB(path string, rules *Rules, numPlayers int) (*FileDB, error) {
+	header := newDBHeader(rules, numPlayers, Float64Encoding)
+	defaultValue := make([]byte, 8*numPlayers)
+	bits := math.Float64bits(1.0 / float64(numPlayers))
+	for i := 0; i < numPlayers; i++ {
+		buf := defaultValue[8*i : 8*(i+1)]
+		binary.LittleEndian.PutUint64(buf, bits)
+	}
+
+	mf, err := openMappedFile(path, header, defaultValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileDB{
+		mappedFile: mf,
+		numPlayers: numPlayers,
+	}, nil
 }
 
-func NewFileDB(path string, numPlayers int) (*FileDB, error) {
-	numStates := calcNumDistinctStates(numPlayers)
-	numEntries := numPlayers * numStates
-	fileSize := int64(8 * numEntries)
+// Open an existing FileDB for reading only. Unlike NewFileDB, it is
+// an error if the file does not exist, and the file may be shared
+// by any number of processes.
+func OpenFileDBReadOnly(path string, rules *Rules, numPlayers int) (*FileDB, error) {
+	header := newDBHeader(rules, numPlayers, Float64Encoding)
+	mf, err := mapFile(path, header, 8*numPlayers, true)
+	if err != nil {
+		return nil, err
+	}
 
-	var f *os.File
-	stat, err := os.Stat(path)
+	return &FileDB{
+		mappedFile: mf,
+		numPlayers: numPlayers,
+	}, nil
+}
+
+// A memory-mapped database file with a header.
+type mappedFile struct {
+	f        *os.File
+	header   DBHeader
+	readOnly bool
+	// Whether the checksum in the header was already stale when opened.
+	staleChecksum bool
+
+	mmap   []byte
+	values []byte
+}
+
+// Open the database file at the given path, which must be compatible with
+// the given header, or create it if it does not exist with every game state
+// initialized to defaultValue.
+func openMappedFile(path string, header DBHeader, defaultValue []byte) (*mappedFile, error) {
+	if err := checkNumSolvedPlayers(header.Rules, header.NumPlayers); err != nil {
+		return nil, err
+	}
+
+	_, err := os.Stat(path)
 	if errors.Is(err, os.ErrNotExist) {
+		numStates := calcNumDistinctStates(header.Rules, header.NumPlayers)
 		glog.Infof("Initializing new database at %s with %d states", path, numStates)
-		f, err = os.Create(path)
+		f, err := os.Create(path)
 		if err != nil {
 			return nil, err
 		}
-		if err := initDB(f, numStates, numPlayers); err != nil {
+		if err := initDB(f, header, numStates, defaultValue); err != nil {
 			_ = f.Close()
 			return nil, err
 		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
 	} else if err != nil {
 		return nil, err
+	}
+
+	return mapFile(path, header, len(defaultValue), false)
+}
+
+// Memory-map an existing database file, which must be compatible with
+// the given header and have entrySize bytes for each game state. The
+// values must match the checksum, unless the file was not closed cleanly.
+// A file opened for writing is marked dirty until it is closed.
+func mapFile(path string, header DBHeader, entrySize int, readOnly bool) (*mappedFile, error) {
+	if err := checkNumSolvedPlayers(header.Rules, header.NumPlayers); err != nil {
+		return nil, err
+	}
+
+	existing, err := ReadDBHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := existing.checkCompatible(header); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	openFlag := os.O_RDWR
+	prot := unix.PROT_READ | unix.PROT_WRITE
+	if readOnly {
+		openFlag = os.O_RDONLY
+		prot = unix.PROT_READ
+	}
+
+	f, err := os.OpenFile(path, openFlag, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	numStates := calcNumDistinctStates(header.Rules, header.NumPlayers)
+	fileSize := int64(dbHeaderSize + dbValuesSize(entrySize, numStates))
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
 	} else if stat.Size() != fileSize {
+		_ = f.Close()
 		return nil, fmt.Errorf(
 			"%s is not the correct size for %d-player database: "+
-				"got %d, expected %d", path, numPlayers, stat.Size(), fileSize)
-	} else {
-		f, err = os.OpenFile(path, os.O_RDWR, 0755)
-		if err != nil {
-			return nil, err
-		}
+				"got %d, expected %d", path, header.NumPlayers, stat.Size(), fileSize)
 	}
 
-	flags := unix.MAP_SHARED
-	prot := unix.PROT_READ | unix.PROT_WRITE
-	mmap, err := unix.Mmap(int(f.Fd()), 0, int(fileSize), prot, flags)
+	mmap, err := unix.Mmap(int(f.Fd()), 0, int(fileSize), prot, unix.MAP_SHARED)
 	if err != nil {
 		_ = f.Close()
 		return nil, err
 	}
 
-	return &FileDB{
-		f:          f,
-		mmap:       mmap,
-		numPlayers: numPlayers,
-	}, nil
+	if err := header.UnmarshalBinary(mmap[:dbHeaderSize]); err != nil {
+		_ = unix.Munmap(mmap)
+		_ = f.Close()
+		return nil, err
+	}
+
+	mf := &mappedFile{
+		f:             f,
+		header:        header,
+		readOnly:      readOnly,
+		staleChecksum: header.Dirty,
+		mmap:          mmap,
+		values:        mmap[dbHeaderSize:],
+	}
+	if header.Dirty {
+		glog.Warningf("%s was not closed cleanly, its checksum cannot be verified", path)
+	} else if err := mf.VerifyChecksum(); err != nil {
+		_ = unix.Munmap(mmap)
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if !readOnly {
+		mf.header.Dirty = true
+		if err := mf.writeHeader(); err != nil {
+			_ = unix.Munmap(mmap)
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	return mf, nil
 }
 
-func initDB(w io.Writer, numStates, numPlayers int) error {
-	bufW := bufio.NewWriterSize(w, 4*1024*1024)
+func checkNumSolvedPlayers(rules *Rules, numPlayers int) error {
+	if numPlayers < 1 || numPlayers > maxNumPlayers {
+		return fmt.Errorf("games with %d players cannot be solved exactly (maximum %d), "+
+			"use an approximate solution", numPlayers, maxNumPlayers)
+	}
+	// Counted in floating point, since the number of states may overflow.
+	numStates := MaxNumDice * math.Pow(float64(rules.numScores()), float64(numPlayers+1))
+	if numStates > maxNumSolvedScoreStates {
+		return fmt.Errorf("games with %d players and scores up to %d cannot be solved exactly "+
+			"(%g states, maximum %g)", numPlayers, rules.Points(rules.maxScore()),
+			numStates, float64(maxNumSolvedScoreStates))
+	}
+	return nil
+}
 
-	defaultValue := make([]byte, 8*numPlayers)
-	bits := math.Float64bits(1.0 / float64(numPlayers))
-	for i := 0; i < numPlayers; i++ {
-		buf := defaultValue[8*i : 8*(i+1)]
-		binary.LittleEndian.PutUint64(buf, bits)
+// Size of the values in a database file with entrySize bytes for each of
+// numStates game states. It is padded to a multiple of 4 bytes so that
+// 16-bit values can be updated through the 32-bit word that contains them
+// (see containingWord) without reading past the end of the file.
+func dbValuesSize(entrySize, numStates int) int {
+	return (entrySize*numStates + 3) &^ 3
+}
+
+func initDB(f *os.File, header DBHeader, numStates int, defaultValue []byte) error {
+	return writeDBFile(f, header, numStates, func(int) []byte {
+		return defaultValue
+	})
+}
+
+// Write a database file with the given header, and the values
+// for each game state ID returned by entry.
+func writeDBFile(f *os.File, header DBHeader, numStates int, entry func(gsID int) []byte) error {
+	// Values are written after space for the header, which is
+	// filled in once the checksum of the values is known.
+	if _, err := f.Seek(dbHeaderSize, io.SeekStart); err != nil {
+		return err
 	}
+	hash := crc32.New(crc32c)
+	bufW := bufio.NewWriterSize(io.MultiWriter(f, hash), 4*1024*1024)
 
+	size := 0
 	for i := 0; i < numStates; i++ {
 		if i%100000000 == 0 {
 			glog.Infof("...%d", i)
 		}
-		bufW.Write(defaultValue)
+		n, err := bufW.Write(entry(i))
+		if err != nil {
+			return err
+		}
+		size += n
+	}
+	// Zero padding up to dbValuesSize, which is included in the checksum.
+	if _, err := bufW.Write(make([]byte, -size&3)); err != nil {
+		return err
+	}
+	if err := bufW.Flush(); err != nil {
+		return err
+	}
+
+	header.Checksum = hash.Sum32()
+	headerBytes, err := header.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteAt(headerBytes, 0)
+	return err
+}
+
+// The rules of databases written before databases had a header:
+// standard scoring in increments of 50 up to 10,000 points, with
+// no minimum opening score.
+var legacyRules = &Rules{
+	Scoring:    StandardScoring,
+	ScoreToWin: 10000,
+}
+
+// Create a FileDB at dstPath from a database solved for numPlayers
+// players before databases had a header. The values are laid out
+// the same way, so they are copied unchanged after the header.
+func ConvertLegacyDB(srcPath, dstPath string, numPlayers int) error {
+	if err := checkNumSolvedPlayers(legacyRules, numPlayers); err != nil {
+		return err
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	numStates := calcNumDistinctStates(legacyRules, numPlayers)
+	entrySize := 8 * numPlayers
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if expected := int64(entrySize) * int64(numStates); stat.Size() != expected {
+		return fmt.Errorf(
+			"%s is not the correct size for a %d-player legacy database: "+
+				"got %d, expected %d", srcPath, numPlayers, stat.Size(), expected)
+	}
+
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	bufR := bufio.NewReaderSize(src, 4*1024*1024)
+	entry := make([]byte, entrySize)
+	var readErr error
+	header := newDBHeader(legacyRules, numPlayers, Float64Encoding)
+	err = writeDBFile(dst, header, numStates, func(int) []byte {
+		if readErr == nil {
+			_, readErr = io.ReadFull(bufR, entry)
+		}
+		return entry
+	})
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		_ = dst.Close()
+		_ = os.Remove(dstPath)
+		return err
 	}
-	return bufW.Flush()
+	return dst.Close()
 }
 
 func (db *FileDB) NumPlayers() int {
@@ -101,47 +335,121 @@ func (db *FileDB) NumPlayers() int {
 }
 
 func (db *FileDB) Put(gs GameState, pWin [maxNumPlayers]float64) {
-	gsID := gs.ID()
-	idx := 8 * db.numPlayers * gsID
-
-	buf := db.mmap[idx : idx+8*db.numPlayers]
-	for i, p := range pWin[:gs.NumPlayers] {
-		value := math.Float64bits(p)
-		binary.LittleEndian.PutUint64(buf[8*i:8*(i+1)], value)
-	}
+	db.checkWritable()
+	db.putID(gs.ID(db.header.Rules), pWin)
 
-	db.nPuts++
-	if db.nPuts%100000 == 0 {
+	if n := db.nPuts.Add(1); n%100000 == 0 {
 		glog.Infof(
 			"%d puts into database. Last put: %s -> %v",
-			db.nPuts, gs, pWin[:gs.NumPlayers])
+			n, db.header.Rules.FormatState(gs), pWin[:gs.NumPlayers])
 	}
 }
 
-func (db *FileDB) Get(gs GameState) [maxNumPlayers]float64 {
-	gsID := gs.ID()
+func (db *FileDB) putID(gsID int, pWin [maxNumPlayers]float64) {
 	idx := 8 * db.numPlayers * gsID
+	buf := db.values[idx : idx+8*db.numPlayers]
+	for i, p := range pWin[:db.numPlayers] {
+		Float64Encoding.store(buf[8*i:8*(i+1)], p)
+	}
+}
 
-	buf := db.mmap[idx : idx+8*db.numPlayers]
+func (db *FileDB) Get(gs GameState) [maxNumPlayers]float64 {
+	return db.getID(gs.ID(db.header.Rules))
+}
+
+func (db *FileDB) getID(gsID int) [maxNumPlayers]float64 {
+	idx := 8 * db.numPlayers * gsID
+	buf := db.values[idx : idx+8*db.numPlayers]
 	var result [maxNumPlayers]float64
 
 	for i := 0; i < db.numPlayers; i++ {
-		value := binary.LittleEndian.Uint64(buf[8*i : 8*(i+1)])
-		result[i] = math.Float64frombits(value)
+		result[i] = Float64Encoding.load(buf[8*i : 8*(i+1)])
 	}
 
 	return result
 }
 
-func (db *FileDB) Close() error {
-	defer db.f.Close()
+// Values are loaded and stored atomically.
+func (mf *mappedFile) concurrent() {}
+
+// The header describing this database.
+func (mf *mappedFile) Header() DBHeader {
+	return mf.header
+}
+
+// Record the completion of a value iteration cycle with the given residual.
+func (mf *mappedFile) RecordIteration(residual float64) error {
+	mf.header.NumIterations++
+	mf.header.LastResidual = residual
+	return mf.writeHeader()
+}
+
+// Check that the stored values match the checksum in the header.
+func (mf *mappedFile) VerifyChecksum() error {
+	if mf.staleChecksum {
+		return errStaleChecksum
+	}
+	if got := checksum(mf.values); got != mf.header.Checksum {
+		return fmt.Errorf("database checksum mismatch: got %08x, expected %08x",
+			got, mf.header.Checksum)
+	}
+	return nil
+}
+
+func (mf *mappedFile) checkWritable() {
+	if mf.readOnly {
+		panic(fmt.Errorf("cannot modify read-only database %s", mf.f.Name()))
+	}
+}
 
-	if err := unix.Msync(db.mmap, unix.MS_SYNC); err != nil {
+func (mf *mappedFile) writeHeader() error {
+	if mf.readOnly {
+		return fmt.Errorf("cannot modify read-only database %s", mf.f.Name())
+	}
+
+	buf, err := mf.header.MarshalBinary()
+	if err != nil {
 		return err
 	}
-	if err := unix.Munmap(db.mmap); err != nil {
+	copy(mf.mmap[:dbHeaderSize], buf)
+	return nil
+}
+
+// Flush all changes to disk.
+func (mf *mappedFile) Sync() error {
+	if mf.readOnly {
+		return nil
+	}
+	return unix.Msync(mf.mmap, unix.MS_SYNC)
+}
+
+// Close the file, updating the checksum in the header if it was modified
+// or was already stale, and marking it as closed cleanly.
+func (mf *mappedFile) close(modified bool) error {
+	defer mf.f.Close()
+
+	if !mf.readOnly {
+		if modified || mf.staleChecksum {
+			mf.header.Checksum = checksum(mf.values)
+		}
+		mf.header.Dirty = false
+		if err := mf.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	if !mf.readOnly {
+		if err := unix.Msync(mf.mmap, unix.MS_SYNC); err != nil {
+			return err
+		}
+	}
+	if err := unix.Munmap(mf.mmap); err != nil {
 		return err
 	}
 
-	return db.f.Close()
+	return mf.f.Close()
+}
+
+func (db *FileDB) Close() error {
+	return db.close(db.nPuts.Load() > 0)
 }
@@ -0,0 +1,115 @@
+package farkle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileDBDirtyUntilClosed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tiny.db")
+	db, err := NewFileDB(path, tinyRules, tinyNumPlayers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put(NewGameState(tinyNumPlayers), [maxNumPlayers]float64{0.75, 0.25})
+
+	header, err := ReadDBHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !header.Dirty {
+		t.Errorf("database open for writing is not marked dirty")
+	}
+
+	// A reader of the unfinished database cannot trust its checksum,
+	// but it is not corrupt either.
+	reader, err := OpenFileDBReadOnly(path, tinyRules, tinyNumPlayers)
+	if err != nil {
+		t.Fatalf("unable to open dirty database: %v", err)
+	}
+	if err := reader.VerifyChecksum(); !errors.Is(err, errStaleChecksum) {
+		t.Errorf("got error %v, expected %v", err, errStaleChecksum)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err = OpenFileDBReadOnly(path, tinyRules, tinyNumPlayers)
+	if err != nil {
+		t.Fatalf("unable to open closed database: %v", err)
+	}
+	defer reader.Close()
+	if reader.Header().Dirty {
+		t.Errorf("closed database is marked dirty")
+	}
+	if err := reader.VerifyChecksum(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenFileDBCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tiny.db")
+	db, err := NewFileDB(path, tinyRules, tinyNumPlayers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{0xff}, dbHeaderSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = OpenFileDBReadOnly(path, tinyRules, tinyNumPlayers)
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("got error %v, expected a checksum mismatch", err)
+	}
+}
+
+func TestConvertLegacyDB(t *testing.T) {
+	// A one-player legacy database is small enough to write in a test.
+	const numPlayers = 1
+	numStates := calcNumDistinctStates(legacyRules, numPlayers)
+	values := make([]byte, 8*numStates)
+	for gsID := 0; gsID < numStates; gsID++ {
+		Float64Encoding.encode(values[8*gsID:], float64(gsID)/float64(numStates))
+	}
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "legacy.db")
+	if err := os.WriteFile(srcPath, values, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dstPath := filepath.Join(dir, "1player.db")
+	if err := ConvertLegacyDB(srcPath, dstPath, numPlayers); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenFileDBReadOnly(dstPath, legacyRules, numPlayers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for gsID := 0; gsID < numStates; gsID++ {
+		if got, expected := db.getID(gsID)[0], float64(gsID)/float64(numStates); got != expected {
+			t.Fatalf("state %d: got %v, expected %v", gsID, got, expected)
+		}
+	}
+
+	if err := ConvertLegacyDB(srcPath, filepath.Join(dir, "2player.db"), 2); err == nil {
+		t.Errorf("converted a legacy database with the wrong number of players")
+	}
+}
@@ -0,0 +1,314 @@
+package farkle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+const dbMagic = "FARKLEDB"
+
+const dbFormatVersion = 1
+
+// Size of the header at the start of a database file. Values are stored
+// after the header, which is padded so that they remain page-aligned.
+const dbHeaderSize = 4096
+
+// DBKind is the kind of solution in a database file, or of the game
+// states it is solved over.
+type DBKind int
+
+const (
+	// The win probabilities of every player in every GameState,
+	// as stored by FileDB and QuantizedDB.
+	ExactSolution DBKind = iota
+	// The win probability of the current player in every ApproxState,
+	// as stored by ApproxDB.
+	ApproxSolution
+	// Every GameState sorted by depth, as written by SaveGameStates.
+	SortedStateList
+	numDBKinds
+)
+
+var dbKindNames = [numDBKinds]string{
+	ExactSolution:   "exact",
+	ApproxSolution:  "approx",
+	SortedStateList: "states",
+}
+
+func (k DBKind) String() string {
+	if k < 0 || k >= numDBKinds {
+		return fmt.Sprintf("DBKind(%d)", int(k))
+	}
+	return dbKindNames[k]
+}
+
+// DBHeader describes the contents of a database file: the game it
+// was solved for and the state of the solver.
+type DBHeader struct {
+	// Version of the file format.
+	Version int
+	// Kind of solution.
+	Kind DBKind
+	// Number of game players.
+	NumPlayers int
+	// Scores are stored as multiples of ScoreIncrement, up to MaxScore.
+	ScoreIncrement int
+	MaxScore       int
+	// Rules the database was solved with.
+	Rules *Rules
+	// How win probabilities are stored.
+	Encoding ValueEncoding
+	// Heuristic strategy the opponents are modeled with in an approximate
+	// solution, as accepted by NewHeuristicStrategy.
+	Opponent string
+	// Number of completed value iteration cycles.
+	NumIterations int
+	// Residual of the last value iteration cycle.
+	LastResidual float64
+	// CRC-32C of the values, as of the last time the database was closed.
+	Checksum uint32
+	// Whether the database is open for writing, or was not closed cleanly,
+	// e.g. because the solver was killed. The checksum is then stale.
+	Dirty bool
+}
+
+// Header for a new, unsolved database.
+func newDBHeader(rules *Rules, numPlayers int, encoding ValueEncoding) DBHeader {
+	return DBHeader{
+		Version:        dbFormatVersion,
+		NumPlayers:     numPlayers,
+		ScoreIncrement: rules.scoreIncrement(),
+		MaxScore:       rules.Points(rules.maxScore()),
+		Rules:          rules,
+		Encoding:       encoding,
+		LastResidual:   math.NaN(),
+	}
+}
+
+func (h DBHeader) String() string {
+	return fmt.Sprintf(
+		"Version=%d, Kind=%v, NumPlayers=%d, ScoreIncrement=%d, MaxScore=%d, Rules: {%v}, "+
+			"Encoding=%v, Opponent=%q, NumIterations=%d, LastResidual=%g, Checksum=%08x, Dirty=%v",
+		h.Version, h.Kind, h.NumPlayers, h.ScoreIncrement, h.MaxScore, h.Rules,
+		h.Encoding, h.Opponent, h.NumIterations, h.LastResidual, h.Checksum, h.Dirty)
+}
+
+// Check that a database with this header can be used in place
+// of one with the expected header.
+func (h DBHeader) checkCompatible(expected DBHeader) error {
+	if h.Kind != expected.Kind {
+		return fmt.Errorf("database has an %v solution, expected %v",
+			h.Kind, expected.Kind)
+	}
+	if h.NumPlayers != expected.NumPlayers {
+		return fmt.Errorf("database is for %d players, expected %d",
+			h.NumPlayers, expected.NumPlayers)
+	}
+	if h.ScoreIncrement != expected.ScoreIncrement || h.MaxScore != expected.MaxScore {
+		return fmt.Errorf("database has scores in increments of %d up to %d, expected %d up to %d",
+			h.ScoreIncrement, h.MaxScore, expected.ScoreIncrement, expected.MaxScore)
+	}
+	if !h.Rules.Equal(expected.Rules) {
+		return fmt.Errorf("database was solved with rules {%v}, expected {%v}",
+			h.Rules, expected.Rules)
+	}
+	if h.Encoding != expected.Encoding {
+		return fmt.Errorf("database has %v encoding, expected %v",
+			h.Encoding, expected.Encoding)
+	}
+	if h.Opponent != expected.Opponent {
+		return fmt.Errorf("database models opponents as %q, expected %q",
+			h.Opponent, expected.Opponent)
+	}
+	return nil
+}
+
+// On-disk encoding of the header, little-endian.
+type dbHeaderV1 struct {
+	Magic           [8]byte
+	Version         uint32
+	NumPlayers      uint32
+	ScoreIncrement  uint32
+	ScoreWidth      uint32
+	MaxScore        uint32
+	ScoreToWin      uint32
+	MinOpeningScore uint32
+	FarklePenalty   uint32
+	ScoringName     [32]byte
+	TrickScores     [numTrickTypes]uint32
+	DoubleNOfAKind  uint32
+	NumIterations   uint64
+	LastResidual    float64
+	Checksum        uint32
+	Encoding        uint32
+	TieBreak        uint32
+	Kind            uint32
+	Opponent        [32]byte
+	Dirty           uint32
+}
+
+func (h DBHeader) MarshalBinary() ([]byte, error) {
+	if len(h.Rules.Scoring.Name) > 32 {
+		return nil, fmt.Errorf("scoring rules name too long: %q", h.Rules.Scoring.Name)
+	}
+	if len(h.Opponent) > 32 {
+		return nil, fmt.Errorf("opponent strategy too long: %q", h.Opponent)
+	}
+
+	enc := dbHeaderV1{
+		Version:         uint32(h.Version),
+		NumPlayers:      uint32(h.NumPlayers),
+		ScoreIncrement:  uint32(h.ScoreIncrement),
+		ScoreWidth:      uint32(h.Rules.scoreWidth()),
+		MaxScore:        uint32(h.MaxScore),
+		ScoreToWin:      uint32(h.Rules.ScoreToWin),
+		MinOpeningScore: uint32(h.Rules.MinOpeningScore),
+		FarklePenalty:   uint32(h.Rules.FarklePenalty),
+		NumIterations:   uint64(h.NumIterations),
+		LastResidual:    h.LastResidual,
+		Checksum:        h.Checksum,
+		Encoding:        uint32(h.Encoding),
+		TieBreak:        uint32(h.Rules.TieBreak),
+		Kind:            uint32(h.Kind),
+	}
+	copy(enc.Magic[:], dbMagic)
+	copy(enc.ScoringName[:], h.Rules.Scoring.Name)
+	copy(enc.Opponent[:], h.Opponent)
+	for i, score := range h.Rules.Scoring.TrickScores {
+		enc.TrickScores[i] = uint32(score)
+	}
+	if h.Rules.Scoring.DoubleNOfAKind {
+		enc.DoubleNOfAKind = 1
+	}
+	if h.Dirty {
+		enc.Dirty = 1
+	}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &enc); err != nil {
+		return nil, err
+	}
+	result := make([]byte, dbHeaderSize)
+	copy(result, buf.Bytes())
+	return result, nil
+}
+
+func (h *DBHeader) UnmarshalBinary(data []byte) error {
+	var enc dbHeaderV1
+	if len(data) < binary.Size(&enc) {
+		return fmt.Errorf("database header too short: %d bytes", len(data))
+	}
+	if string(data[:len(dbMagic)]) != dbMagic {
+		return fmt.Errorf("not a farkle database (missing header)")
+	}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &enc); err != nil {
+		return err
+	}
+	if enc.Version != dbFormatVersion {
+		return fmt.Errorf("unsupported database format version %d", enc.Version)
+	}
+	if enc.Encoding >= uint32(numValueEncodings) {
+		return fmt.Errorf("unsupported value encoding %d", enc.Encoding)
+	}
+	if enc.TieBreak >= uint32(numTieBreaks) {
+		return fmt.Errorf("unsupported tie-break policy %d", enc.TieBreak)
+	}
+	if enc.Kind >= uint32(numDBKinds) {
+		return fmt.Errorf("unsupported solution kind %d", enc.Kind)
+	}
+	if enc.ScoreWidth < 1 || enc.ScoreWidth > maxScoreWidth {
+		return fmt.Errorf("unsupported score width %d", enc.ScoreWidth)
+	}
+
+	scoring := &ScoringRules{
+		Name:           strings.TrimRight(string(enc.ScoringName[:]), "\x00"),
+		DoubleNOfAKind: enc.DoubleNOfAKind != 0,
+	}
+	for i, score := range enc.TrickScores {
+		scoring.TrickScores[i] = int(score)
+	}
+	scoring = scoring.canonical()
+
+	*h = DBHeader{
+		Version:        int(enc.Version),
+		Kind:           DBKind(enc.Kind),
+		NumPlayers:     int(enc.NumPlayers),
+		ScoreIncrement: int(enc.ScoreIncrement),
+		MaxScore:       int(enc.MaxScore),
+		Rules: &Rules{
+			Scoring:         scoring,
+			ScoreToWin:      int(enc.ScoreToWin),
+			MinOpeningScore: int(enc.MinOpeningScore),
+			FarklePenalty:   int(enc.FarklePenalty),
+			ScoreIncrement:  int(enc.ScoreIncrement),
+			ScoreWidth:      int(enc.ScoreWidth),
+			TieBreak:        TieBreak(enc.TieBreak),
+		},
+		Encoding:      ValueEncoding(enc.Encoding),
+		Opponent:      strings.TrimRight(string(enc.Opponent[:]), "\x00"),
+		NumIterations: int(enc.NumIterations),
+		LastResidual:  enc.LastResidual,
+		Checksum:      enc.Checksum,
+		Dirty:         enc.Dirty != 0,
+	}
+	return nil
+}
+
+// Read the header of the database file at the given path.
+func ReadDBHeader(path string) (DBHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return DBHeader{}, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, dbHeaderSize)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return DBHeader{}, fmt.Errorf("%s: error reading database header: %w", path, err)
+	}
+
+	var h DBHeader
+	if err := h.UnmarshalBinary(buf); err != nil {
+		return DBHeader{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return h, nil
+}
+
+// Read the rules that the databases at the given paths, exact or
+// approximate, were solved with. They must all have the same rules.
+func ReadDBRules(paths ...string) (*Rules, error) {
+	var rules *Rules
+	for _, path := range paths {
+		h, err := ReadDBHeader(path)
+		if err != nil {
+			return nil, err
+		}
+		if rules == nil {
+			rules = h.Rules
+		} else if !h.Rules.Equal(rules) {
+			return nil, fmt.Errorf("%s was solved with rules {%v}, expected {%v}",
+				path, h.Rules, rules)
+		}
+	}
+	if rules == nil {
+		return nil, fmt.Errorf("no databases to read rules from")
+	}
+	return rules, nil
+}
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// Returned by VerifyChecksum for a database that was not closed
+// cleanly, whose checksum does not describe its values.
+var errStaleChecksum = errors.New("checksum is stale: database was not closed cleanly")
+
+func checksum(data []byte) uint32 {
+	return crc32.Checksum(data, crc32c)
+}
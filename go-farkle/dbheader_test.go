@@ -0,0 +1,121 @@
+package farkle
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDBHeaderRoundTrip(t *testing.T) {
+	penaltyRules := &Rules{
+		Scoring:         DoublingScoring,
+		ScoreToWin:      5000,
+		MinOpeningScore: 350,
+		FarklePenalty:   500,
+		ScoreWidth:      2,
+		TieBreak:        SuddenDeath,
+	}
+	custom := &Rules{
+		Scoring: &ScoringRules{
+			Name:        "custom",
+			TrickScores: [numTrickTypes]int{Single1: 100, Single5: 100, Three1s: 1000},
+		},
+		ScoreToWin:     2000,
+		ScoreIncrement: 100,
+		TieBreak:       TiesLose,
+	}
+
+	solved := newDBHeader(custom, 3, Uint16Encoding)
+	solved.NumIterations = 12
+	solved.LastResidual = 3.5e-7
+	solved.Checksum = 0xdeadbeef
+	dirty := newDBHeader(DefaultRules, 4, Float64Encoding)
+	dirty.Dirty = true
+
+	testCases := []struct {
+		name   string
+		header DBHeader
+	}{
+		{"new exact", newDBHeader(DefaultRules, 2, Float64Encoding)},
+		{"penalty and sudden death", newDBHeader(penaltyRules, 2, Float32Encoding)},
+		{"approx", newApproxDBHeader(DefaultRules, 6, "catchup:1000:0.5")},
+		{"states", newGameStatesHeader(custom, 3)},
+		{"solved", solved},
+		{"dirty", dirty},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := tc.header.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) != dbHeaderSize {
+				t.Fatalf("header is %d bytes, expected %d", len(data), dbHeaderSize)
+			}
+
+			var got DBHeader
+			if err := got.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			if !got.Rules.Equal(tc.header.Rules) {
+				t.Errorf("got rules {%v}, expected {%v}", got.Rules, tc.header.Rules)
+			}
+			sameResidual := got.LastResidual == tc.header.LastResidual ||
+				math.IsNaN(got.LastResidual) && math.IsNaN(tc.header.LastResidual)
+			// Rules are compared above, and NaN residuals are not equal.
+			expected := tc.header
+			got.Rules, got.LastResidual, expected.LastResidual = expected.Rules, 0, 0
+			if got != expected || !sameResidual {
+				t.Errorf("got header %v, expected %v", got, tc.header)
+			}
+		})
+	}
+}
+
+func TestDBHeaderPresetScoringShared(t *testing.T) {
+	data, err := newDBHeader(DefaultRules, 2, Float64Encoding).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h DBHeader
+	if err := h.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if h.Rules.Scoring != DefaultRules.Scoring {
+		t.Errorf("preset scoring rules were not shared")
+	}
+}
+
+func TestDBHeaderUnmarshalErrors(t *testing.T) {
+	valid, err := newDBHeader(DefaultRules, 2, Float64Encoding).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(offset int, b byte) []byte {
+		data := append([]byte(nil), valid...)
+		data[offset] = b
+		return data
+	}
+
+	testCases := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"too short", valid[:16], "too short"},
+		{"no magic", corrupt(0, 'X'), "missing header"},
+		{"version", corrupt(len(dbMagic), 2), "version"},
+		{"score width", corrupt(len(dbMagic)+12, 3), "score width"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var h DBHeader
+			err := h.UnmarshalBinary(tc.data)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %v, expected one about %s", err, tc.wantErr)
+			}
+		})
+	}
+}
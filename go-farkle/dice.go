@@ -31,6 +31,8 @@ func NewRoll(dice ...uint8) Roll {
 	return roll
 }
 
+// Roll dice using the global math/rand source.
+// Use RollDice with a DiceSource for reproducible rolls.
 func NewRandomRoll(numDice int) Roll {
 	var roll Roll
 	for i := 0; i < numDice; i++ {
@@ -75,10 +77,48 @@ func SubtractRolls(a, b Roll) Roll {
 	return result
 }
 
+// Parse a roll written as its dice, e.g. "112456" or "1 1 2 4 5 6".
+// Spaces and commas between dice are ignored.
+func ParseRoll(s string) (Roll, error) {
+	var roll Roll
+	for _, c := range s {
+		if c == ' ' || c == ',' {
+			continue
+		}
+		if c < '1' || c > '0'+numSides {
+			return Roll{}, fmt.Errorf("not a valid die: '%c'", c)
+		}
+		if roll.NumDice() == MaxNumDice {
+			return Roll{}, fmt.Errorf("too many dice in %q: max %d", s, MaxNumDice)
+		}
+		roll[c-'0']++
+	}
+
+	return roll, nil
+}
+
 func (r Roll) String() string {
 	return fmt.Sprintf("%v", r.Dice())
 }
 
+// The roll written as its dice, e.g. "112456", as parsed by ParseRoll.
+func (r Roll) MarshalText() ([]byte, error) {
+	result := make([]byte, 0, MaxNumDice)
+	for _, die := range r.Dice() {
+		result = append(result, '0'+die)
+	}
+	return result, nil
+}
+
+func (r *Roll) UnmarshalText(text []byte) error {
+	roll, err := ParseRoll(string(text))
+	if err != nil {
+		return err
+	}
+	*r = roll
+	return nil
+}
+
 // The dice in this roll, sorted in ascending order.
 func (r Roll) Dice() []uint8 {
 	result := make([]uint8, 0, r.NumDice())
@@ -168,6 +208,12 @@ var allRolls = func() [MaxNumDice + 1][]WeightedRoll {
 	return result
 }()
 
+// All distinct rolls of the given number of dice, and their probabilities.
+// The result is shared and must not be modified.
+func AllRolls(numDice int) []WeightedRoll {
+	return allRolls[numDice]
+}
+
 // Number of distinct rolls of 1 - maxNumDice.
 var nDistinctRolls = func() int {
 	n := 0
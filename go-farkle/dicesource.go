@@ -0,0 +1,262 @@
+package farkle
+
+import (
+	"bufio"
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DiceSource produces the dice rolled in a game.
+type DiceSource interface {
+	// Roll a single die, returning a value in [1, 6].
+	RollDie() (uint8, error)
+}
+
+// Returned by a ScriptedDice when it has no dice left.
+var ErrDiceExhausted = errors.New("scripted dice exhausted")
+
+// Roll the given number of dice from the source.
+func RollDice(src DiceSource, numDice int) (Roll, error) {
+	var roll Roll
+	for i := 0; i < numDice; i++ {
+		die, err := src.RollDie()
+		if err != nil {
+			return Roll{}, err
+		}
+		if die < 1 || die > numSides {
+			panic(fmt.Errorf("dice source rolled invalid die = %d", die))
+		}
+		roll[die]++
+	}
+	return roll, nil
+}
+
+// Pseudo-random dice that roll the same sequence for the same seed.
+// Not safe for concurrent use.
+type SeededDice struct {
+	rng *rand.Rand
+}
+
+func NewSeededDice(seed int64) *SeededDice {
+	return &SeededDice{rng: rand.New(rand.NewSource(seed))}
+}
+
+func (d *SeededDice) RollDie() (uint8, error) {
+	return uint8(1 + d.rng.Intn(numSides)), nil
+}
+
+// Dice rolled with a cryptographically secure random number generator,
+// which cannot be reproduced or predicted. Safe for concurrent use.
+type CryptoDice struct{}
+
+func (CryptoDice) RollDie() (uint8, error) {
+	var b [1]byte
+	for {
+		if _, err := crand.Read(b[:]); err != nil {
+			return 0, fmt.Errorf("error reading random bytes: %w", err)
+		}
+		// Reject the values that would bias the result.
+		if b[0] < 256-256%numSides {
+			return 1 + b[0]%numSides, nil
+		}
+	}
+}
+
+// Dice that roll a fixed sequence, one die at a time. The order of the
+// dice within a roll does not matter. Rolling more dice than the script
+// holds returns ErrDiceExhausted. Safe for concurrent use, although
+// concurrent games would interleave the sequence.
+type ScriptedDice struct {
+	mu   sync.Mutex
+	dice []uint8
+	next int
+	// File the script was loaded from by ParseDiceSource, if any.
+	path string
+}
+
+func NewScriptedDice(dice ...uint8) *ScriptedDice {
+	for _, die := range dice {
+		if die < 1 || die > numSides {
+			panic(fmt.Errorf("cannot script die = %d", die))
+		}
+	}
+	return &ScriptedDice{dice: dice}
+}
+
+func (d *ScriptedDice) RollDie() (uint8, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.next >= len(d.dice) {
+		return 0, fmt.Errorf("%w after %d dice", ErrDiceExhausted, len(d.dice))
+	}
+	die := d.dice[d.next]
+	d.next++
+	return die, nil
+}
+
+// Number of dice left in the script.
+func (d *ScriptedDice) Remaining() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.dice) - d.next
+}
+
+// Number of dice rolled from the script so far.
+func (d *ScriptedDice) Position() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.next
+}
+
+// Specification of a script loaded by ParseDiceSource, as accepted by
+// ParseDiceSource, that rolls the dice left in the script from here on,
+// e.g. "file:dice.txt@12". Empty if the script was not loaded from a file.
+func (d *ScriptedDice) Spec() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.path == "" {
+		return ""
+	}
+	return fmt.Sprintf("file:%s@%d", d.path, d.next)
+}
+
+// Dice that remember every die rolled from another source, so that
+// a game can be rewound and the same dice rolled again, as they would
+// have been had the game been played without rewinding.
+// Not safe for concurrent use.
+type RewindableDice struct {
+	src  DiceSource
+	dice []uint8
+	next int
+}
+
+func NewRewindableDice(src DiceSource) *RewindableDice {
+	return &RewindableDice{src: src}
+}
+
+func (d *RewindableDice) RollDie() (uint8, error) {
+	if d.next == len(d.dice) {
+		die, err := d.src.RollDie()
+		if err != nil {
+			return 0, err
+		}
+		d.dice = append(d.dice, die)
+	}
+	die := d.dice[d.next]
+	d.next++
+	return die, nil
+}
+
+// Number of dice rolled so far.
+func (d *RewindableDice) Position() int {
+	return d.next
+}
+
+// Rewind to an earlier position, as returned by Position,
+// so that the dice rolled since are rolled again.
+func (d *RewindableDice) Rewind(pos int) {
+	if pos < 0 || pos > d.next {
+		panic(fmt.Errorf("cannot rewind dice to %d, only %d rolled", pos, d.next))
+	}
+	d.next = pos
+}
+
+// Load a dice script from a file. Each die is a digit 1-6; spaces,
+// commas and line breaks are ignored, and lines starting with # are
+// comments. For example, one roll per line:
+//
+//	# Turn 1
+//	1 1 2 3 5 6
+//	2 4 6
+func LoadDiceScript(path string) ([]uint8, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var dice []uint8
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, c := range line {
+			switch {
+			case c >= '1' && c <= '0'+numSides:
+				dice = append(dice, uint8(c-'0'))
+			case c == ' ' || c == '\t' || c == ',':
+			default:
+				return nil, fmt.Errorf("%s:%d: invalid die %q", path, lineNo, c)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return dice, nil
+}
+
+// Dice sources accepted by ParseDiceSource.
+var DiceSourceUsage = []string{
+	"seed[:<seed>]",
+	"crypto",
+	"file:<path>[@<position>]",
+}
+
+// Create a dice source from a specification such as "seed:42".
+// A seeded source without an explicit seed uses defaultSeed, and a
+// script given a position starts after that many dice.
+// See DiceSourceUsage for the available sources.
+func ParseDiceSource(spec string, defaultSeed int64) (DiceSource, error) {
+	kind, arg, hasArg := strings.Cut(spec, ":")
+	switch kind {
+	case "seed":
+		seed := defaultSeed
+		if hasArg {
+			var err error
+			seed, err = strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid seed: %w", err)
+			}
+		}
+		return NewSeededDice(seed), nil
+	case "crypto":
+		if hasArg {
+			return nil, fmt.Errorf("crypto dice take no parameters")
+		}
+		return CryptoDice{}, nil
+	case "file":
+		path, pos := arg, 0
+		if i := strings.LastIndexByte(arg, '@'); i >= 0 {
+			var err error
+			path = arg[:i]
+			pos, err = strconv.Atoi(arg[i+1:])
+			if err != nil || pos < 0 {
+				return nil, fmt.Errorf("invalid position in dice script: %q", arg[i+1:])
+			}
+		}
+		dice, err := LoadDiceScript(path)
+		if err != nil {
+			return nil, err
+		}
+		if pos > len(dice) {
+			return nil, fmt.Errorf("%s has %d dice, cannot start after %d", path, len(dice), pos)
+		}
+		script := NewScriptedDice(dice...)
+		script.next = pos
+		script.path = path
+		return script, nil
+	default:
+		return nil, fmt.Errorf("unknown dice source %q, valid options: %s",
+			spec, strings.Join(DiceSourceUsage, ", "))
+	}
+}
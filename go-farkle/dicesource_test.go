@@ -0,0 +1,83 @@
+package farkle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func rollAll(t *testing.T, dice DiceSource, numDice ...int) []Roll {
+	t.Helper()
+	rolls := make([]Roll, len(numDice))
+	for i, n := range numDice {
+		roll, err := RollDice(dice, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rolls[i] = roll
+	}
+	return rolls
+}
+
+func TestRewindableDiceReplaysAfterUndo(t *testing.T) {
+	expected := rollAll(t, NewSeededDice(42), 6, 3, 6, 2)
+
+	dice := NewRewindableDice(NewSeededDice(42))
+	first := rollAll(t, dice, 6)
+	pos := dice.Position()
+	rollAll(t, dice, 3, 6)
+	// Undo the decision after the second roll, and replay from it.
+	dice.Rewind(pos)
+	got := append(first, rollAll(t, dice, 3, 6, 2)...)
+
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("roll %d after rewinding: got %v, expected %v", i, got[i], expected[i])
+		}
+	}
+}
+
+func TestRewindableDiceExhausted(t *testing.T) {
+	dice := NewRewindableDice(NewScriptedDice(1, 2, 3))
+	rollAll(t, dice, 3)
+	dice.Rewind(0)
+	rollAll(t, dice, 3)
+	if _, err := RollDice(dice, 1); !errors.Is(err, ErrDiceExhausted) {
+		t.Errorf("got error %v, expected %v", err, ErrDiceExhausted)
+	}
+}
+
+func TestParseDiceSourceScriptPosition(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dice.txt")
+	if err := os.WriteFile(path, []byte("1 2 3\n4 5 6\n# Turn 2\n1 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := ParseDiceSource("file:"+path+"@2", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dice := src.(*ScriptedDice)
+	rollAll(t, dice, 3)
+	spec := dice.Spec()
+	if expected := "file:" + path + "@5"; spec != expected {
+		t.Errorf("got spec %q, expected %q", spec, expected)
+	}
+
+	// The spec rolls the rest of the script.
+	replay, err := ParseDiceSource(spec, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, expected := rollAll(t, replay, 3), rollAll(t, dice, 3)
+	if got[0] != expected[0] {
+		t.Errorf("replayed %v, expected %v", got[0], expected[0])
+	}
+
+	for _, pos := range []string{"-1", "abc", "9"} {
+		if _, err := ParseDiceSource("file:"+path+"@"+pos, 0); err == nil {
+			t.Errorf("parsed script with invalid position %s", pos)
+		}
+	}
+}
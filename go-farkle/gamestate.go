@@ -1,20 +1,32 @@
 package farkle
 
 import (
+	"encoding/binary"
 	"fmt"
-	"math"
+	"slices"
 )
 
+// Games with more players are too large to solve exactly, and are
+// played with a Table and solved approximately with an ApproxDB.
 const maxNumPlayers = 4
-const maxSizeOfGameState = 7
+
+// Largest number of distinct game states, ignoring consecutive farkles,
+// that can be solved exactly: that of a 4-player game with 1-byte scores.
+const maxNumSolvedScoreStates = MaxNumDice << 40
 
 // State of the game. The current player is always player 0.
-// Game states can be partially ordered since scores can only go up during game play.
+// Game states can be partially ordered since scores can only go up during game play,
+// unless the rules impose a penalty for consecutive farkles.
+// Scores are in units of the score increment of the Rules.
 type GameState struct {
-	ScoreThisRound uint8
+	ScoreThisRound uint16
 	NumDiceToRoll  uint8
 	NumPlayers     uint8
-	PlayerScores   [maxNumPlayers]uint8
+	PlayerScores   [maxNumPlayers]uint16
+	// Number of turns in a row that each player has farkled.
+	// Only tracked if the rules have a FarklePenalty, and always
+	// less than NumFarklesForPenalty.
+	ConsecutiveFarkles [maxNumPlayers]uint8
 }
 
 func NewGameState(numPlayers int) GameState {
@@ -29,68 +41,135 @@ func NewGameState(numPlayers int) GameState {
 	}
 }
 
-func GameStateFromBytes(buf []byte) GameState {
+// Deserialize a game state written by SerializeTo with the same rules.
+func GameStateFromBytes(rules *Rules, buf []byte) GameState {
+	width := rules.scoreWidth()
 	gs := GameState{
-		ScoreThisRound: buf[0],
-		NumDiceToRoll:  buf[1],
-		NumPlayers:     buf[2],
+		ScoreThisRound: getScore(buf, width),
+		NumDiceToRoll:  buf[width],
+		NumPlayers:     buf[width+1],
 	}
 
-	copy(gs.PlayerScores[:gs.NumPlayers], buf[3:])
+	buf = buf[width+2:]
+	for i := range gs.PlayerScores[:gs.NumPlayers] {
+		gs.PlayerScores[i] = getScore(buf[i*width:], width)
+	}
+	gs.ConsecutiveFarkles = unpackFarkles(buf[int(gs.NumPlayers)*width])
 	return gs
 }
 
+// Number of bytes in a serialized game state.
+func sizeOfGameState(rules *Rules, numPlayers int) int {
+	return (numPlayers+1)*rules.scoreWidth() + 3
+}
+
+// Scores are serialized little-endian in the given number of bytes.
+func putScore(buf []byte, width int, score uint16) {
+	if width == 1 {
+		buf[0] = uint8(score)
+	} else {
+		binary.LittleEndian.PutUint16(buf, score)
+	}
+}
+
+func getScore(buf []byte, width int) uint16 {
+	if width == 1 {
+		return uint16(buf[0])
+	}
+	return binary.LittleEndian.Uint16(buf)
+}
+
+// Consecutive farkles are packed 2 bits per player in a byte.
+func packFarkles(farkles [maxNumPlayers]uint8) byte {
+	var b byte
+	for i, n := range farkles {
+		b |= n << (2 * i)
+	}
+	return b
+}
+
+func unpackFarkles(b byte) [maxNumPlayers]uint8 {
+	var farkles [maxNumPlayers]uint8
+	for i := range farkles {
+		farkles[i] = (b >> (2 * i)) & 0x3
+	}
+	return farkles
+}
+
+// Scores are formatted in units of the score increment,
+// which depends on the rules. See Rules.FormatState.
 func (gs GameState) String() string {
-	var scores [maxNumPlayers]int
-	for i := 0; i < int(gs.NumPlayers); i++ {
-		scores[i] = incr * int(gs.PlayerScores[i])
+	return gs.format(func(score uint16) int { return int(score) })
+}
+
+func (gs GameState) format(points func(uint16) int) string {
+	n := gs.NumPlayers
+	return formatState(points, gs.ScoreThisRound, gs.NumDiceToRoll,
+		gs.PlayerScores[:n], gs.ConsecutiveFarkles[:n])
+}
+
+// Format the fields of a GameState or Table.
+func formatState(points func(uint16) int, scoreThisRound uint16, numDiceToRoll uint8,
+	playerScores []uint16, consecutiveFarkles []uint8) string {
+	scores := make([]int, len(playerScores))
+	for i, score := range playerScores {
+		scores[i] = points(score)
 	}
-	return fmt.Sprintf(
+	result := fmt.Sprintf(
 		"NumDiceToRoll=%d, ScoreThisRound=%d, Scores: %v",
-		gs.NumDiceToRoll, incr*int(gs.ScoreThisRound), scores[:gs.NumPlayers])
+		numDiceToRoll, points(scoreThisRound), scores)
+	if slices.ContainsFunc(consecutiveFarkles, func(n uint8) bool { return n > 0 }) {
+		result += fmt.Sprintf(", ConsecutiveFarkles: %v", consecutiveFarkles)
+	}
+	return result
 }
 
 // A unique ID for this game state within the set of all
-// possible games with a certain number of players.
-func (gs GameState) ID() int {
+// possible games with a certain number of players and rules.
+func (gs GameState) ID(rules *Rules) int {
 	// The IDs should be arranged so that there is locality in the
 	// as process all states.
 	// First the number of dice to roll.
-	idx := int(gs.NumDiceToRoll-1) << ((gs.NumPlayers + 1) * numScoreBits)
-	// First dimensions are player scores.
 	numPlayers := int(gs.NumPlayers)
-	for i, score := range gs.PlayerScores[:numPlayers] {
-		idx += int(score) << ((numPlayers - i) * numScoreBits)
+	numScores := rules.numScores()
+	idx := int(gs.NumDiceToRoll - 1)
+	// Next dimensions are player scores.
+	for _, score := range gs.PlayerScores[:numPlayers] {
+		idx = idx*numScores + int(score)
 	}
 	// Then current player score this round.
-	idx += int(gs.ScoreThisRound)
+	idx = idx*numScores + int(gs.ScoreThisRound)
+	// Finally the consecutive farkles of each player, which are always
+	// zero unless the rules have a farkle penalty.
+	farkleIdx := 0
+	for i := numPlayers - 1; i >= 0; i-- {
+		farkleIdx = farkleIdx*NumFarklesForPenalty + int(gs.ConsecutiveFarkles[i])
+	}
+	idx += farkleIdx * calcNumDistinctScoreStates(rules, numPlayers)
 	return idx
 }
 
 // Whether the game is over, i.e. this is a terminal game state.
-func (gs GameState) IsGameOver() bool {
+func (gs GameState) IsGameOver(rules *Rules) bool {
 	// After a player exceeds the score to win, other players get one more turn.
 	// Therefore the game is over when we come back around such that the current player
 	// has a score exceeding the threshold.
-	return gs.CurrentPlayerScore() >= scoreToWin
+	return gs.CurrentPlayerScore() >= rules.scoreToWin()
 }
 
 // Score of the current player.
-func (gs GameState) CurrentPlayerScore() uint8 {
+func (gs GameState) CurrentPlayerScore() uint16 {
 	return gs.PlayerScores[0]
 }
 
 // Current player has certainly won if they stop now.
 // This is used as an optimization to avoid further traversing the tree,
 // since there is no reason for the player to continue.
-func (gs GameState) CurrentPlayerHasWon() bool {
-	currentTotalScore := gs.CurrentPlayerScore() + gs.ScoreThisRound
-	if currentTotalScore < gs.CurrentPlayerScore() {
-		currentTotalScore = math.MaxUint8 // Overflow
-	}
+func (gs GameState) CurrentPlayerHasWon(rules *Rules) bool {
+	currentTotalScore := addScores(rules, gs.CurrentPlayerScore(), gs.ScoreThisRound)
 
 	nextPlayerScore := gs.PlayerScores[1]
-	if nextPlayerScore >= scoreToWin {
+	if nextPlayerScore >= rules.scoreToWin() {
 		// Our turn is the last turn.
 		return currentTotalScore >= nextPlayerScore
 	}
@@ -99,9 +178,13 @@ func (gs GameState) CurrentPlayerHasWon() bool {
 }
 
 // Highest score of any player.
-func (gs GameState) HighestScore() uint8 {
-	bestScore := uint8(0)
-	for _, score := range gs.PlayerScores[:gs.NumPlayers] {
+func (gs GameState) HighestScore() uint16 {
+	return highestScore(gs.PlayerScores[:gs.NumPlayers])
+}
+
+func highestScore(scores []uint16) uint16 {
+	bestScore := uint16(0)
+	for _, score := range scores {
 		if score > bestScore {
 			bestScore = score
 		}
@@ -109,15 +192,20 @@ func (gs GameState) HighestScore() uint8 {
 	return bestScore
 }
 
-func (gs GameState) ToBytes() []byte {
-	nBytes := gs.NumPlayers + 3
-	buf := make([]byte, nBytes)
-	n := gs.SerializeTo(buf)
+// Add two scores, saturating at the highest score that can be represented.
+func addScores(rules *Rules, a, b uint16) uint16 {
+	return uint16(min(int(a)+int(b), int(rules.maxScore())))
+}
+
+func (gs GameState) ToBytes(rules *Rules) []byte {
+	buf := make([]byte, sizeOfGameState(rules, int(gs.NumPlayers)))
+	n := gs.SerializeTo(rules, buf)
 	return buf[:n]
 }
 
-func (gs GameState) SerializeTo(buf []byte) int {
-	nBytes := int(gs.NumPlayers + 3)
+// Serialize the game state, with scores in the score width of the rules.
+func (gs GameState) SerializeTo(rules *Rules, buf []byte) int {
+	nBytes := sizeOfGameState(rules, int(gs.NumPlayers))
 	if len(buf) < nBytes {
 		panic(fmt.Errorf(
 			"cannot serialize GameState: "+
@@ -125,13 +213,33 @@ func (gs GameState) SerializeTo(buf []byte) int {
 			len(buf), nBytes))
 	}
 
-	buf[0] = gs.ScoreThisRound
-	buf[1] = gs.NumDiceToRoll
-	buf[2] = gs.NumPlayers
-	copy(buf[3:], gs.PlayerScores[:gs.NumPlayers])
+	width := rules.scoreWidth()
+	putScore(buf, width, gs.ScoreThisRound)
+	buf[width] = gs.NumDiceToRoll
+	buf[width+1] = gs.NumPlayers
+	scores := buf[width+2:]
+	for i, score := range gs.PlayerScores[:gs.NumPlayers] {
+		putScore(scores[i*width:], width, score)
+	}
+	scores[int(gs.NumPlayers)*width] = packFarkles(gs.ConsecutiveFarkles)
 	return nBytes
 }
 
-func calcNumDistinctStates(numPlayers int) int {
-	return MaxNumDice << ((numPlayers + 1) * numScoreBits)
+func calcNumDistinctStates(rules *Rules, numPlayers int) int {
+	numStates := calcNumDistinctScoreStates(rules, numPlayers)
+	if rules.FarklePenalty > 0 {
+		for i := 0; i < numPlayers; i++ {
+			numStates *= NumFarklesForPenalty
+		}
+	}
+	return numStates
+}
+
+// Number of distinct states ignoring consecutive farkles.
+func calcNumDistinctScoreStates(rules *Rules, numPlayers int) int {
+	numStates := MaxNumDice
+	for i := 0; i <= numPlayers; i++ {
+		numStates *= rules.numScores()
+	}
+	return numStates
 }
@@ -0,0 +1,210 @@
+package farkle
+
+import "testing"
+
+// Call fn with every distinct game state of the given number of players.
+func forEachGameState(rules *Rules, numPlayers int, fn func(GameState)) {
+	numFarkles := 1
+	if rules.FarklePenalty > 0 {
+		numFarkles = NumFarklesForPenalty
+	}
+	var visit func(gs GameState, player int)
+	visit = func(gs GameState, player int) {
+		if player == numPlayers {
+			for numDice := 1; numDice <= MaxNumDice; numDice++ {
+				for score := 0; score < rules.numScores(); score++ {
+					gs.NumDiceToRoll = uint8(numDice)
+					gs.ScoreThisRound = uint16(score)
+					fn(gs)
+				}
+			}
+			return
+		}
+		for score := 0; score < rules.numScores(); score++ {
+			for farkles := 0; farkles < numFarkles; farkles++ {
+				gs.PlayerScores[player] = uint16(score)
+				gs.ConsecutiveFarkles[player] = uint8(farkles)
+				visit(gs, player+1)
+			}
+		}
+	}
+	visit(NewGameState(numPlayers), 0)
+}
+
+func TestFarklePenalty(t *testing.T) {
+	rules := &Rules{
+		Scoring:       StandardScoring,
+		ScoreToWin:    10000,
+		FarklePenalty: 500,
+	}
+	noPenalty := &Rules{
+		Scoring:    StandardScoring,
+		ScoreToWin: 10000,
+	}
+	bank := Action{HeldDiceID: GetRollID(NewRoll(1))}
+
+	testCases := []struct {
+		name        string
+		rules       *Rules
+		score       int
+		farkles     uint8
+		action      Action
+		wantScore   int
+		wantFarkles uint8
+	}{
+		{"first farkle", rules, 1000, 0, Action{}, 1000, 1},
+		{"second farkle", rules, 1000, 1, Action{}, 1000, 2},
+		{"third farkle", rules, 1000, 2, Action{}, 500, 0},
+		{"third farkle below penalty", rules, 300, 2, Action{}, 0, 0},
+		{"bank resets", rules, 1000, 2, bank, 1100, 0},
+		{"no penalty", noPenalty, 1000, 0, Action{}, 1000, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := NewGameState(2)
+			score, err := tc.rules.ScoreUnits(tc.score)
+			if err != nil {
+				t.Fatal(err)
+			}
+			state.PlayerScores[0] = score
+			state.ConsecutiveFarkles[0] = tc.farkles
+			state.NumDiceToRoll = 1
+
+			// The current player moves to the last seat.
+			next := ApplyAction(tc.rules, state, tc.action)
+			if got := tc.rules.Points(next.PlayerScores[1]); got != tc.wantScore {
+				t.Errorf("score = %d, expected %d", got, tc.wantScore)
+			}
+			if got := next.ConsecutiveFarkles[1]; got != tc.wantFarkles {
+				t.Errorf("consecutive farkles = %d, expected %d", got, tc.wantFarkles)
+			}
+		})
+	}
+}
+
+func TestGameStateIDWithFarkles(t *testing.T) {
+	rules := &Rules{
+		Scoring: &ScoringRules{
+			Name: "singles",
+			TrickScores: [numTrickTypes]int{
+				Single1: 100,
+				Single5: 100,
+			},
+		},
+		ScoreToWin:     300,
+		FarklePenalty:  100,
+		ScoreIncrement: 100,
+	}
+	const numPlayers = 2
+
+	numStates := calcNumDistinctStates(rules, numPlayers)
+	seen := make([]bool, numStates)
+	forEachGameState(rules, numPlayers, func(gs GameState) {
+		id := gs.ID(rules)
+		if id < 0 || id >= numStates {
+			t.Fatalf("state %v: ID %d out of range [0, %d)", gs, id, numStates)
+		}
+		if seen[id] {
+			t.Fatalf("state %v: duplicate ID %d", gs, id)
+		}
+		seen[id] = true
+
+		if got := GameStateFromBytes(rules, gs.ToBytes(rules)); got != gs {
+			t.Fatalf("state %v: round-trip gave %v", gs, got)
+		}
+	})
+	for id, ok := range seen {
+		if !ok {
+			t.Fatalf("no state has ID %d", id)
+		}
+	}
+}
+
+func TestGameStateIDScoreWidth(t *testing.T) {
+	singles := &ScoringRules{
+		Name: "singles",
+		TrickScores: [numTrickTypes]int{
+			Single1: 100,
+			Single5: 100,
+		},
+	}
+
+	testCases := []struct {
+		name       string
+		rules      *Rules
+		numPlayers int
+		maxScore   uint16
+	}{
+		{
+			name:       "1 byte, capped",
+			rules:      &Rules{Scoring: singles, ScoreToWin: 300, ScoreIncrement: 2, ScoreWidth: 1},
+			numPlayers: 1,
+			maxScore:   255,
+		},
+		{
+			name:       "2 bytes",
+			rules:      &Rules{Scoring: singles, ScoreToWin: 300, ScoreIncrement: 2, ScoreWidth: 2},
+			numPlayers: 1,
+			maxScore:   450,
+		},
+		{
+			name:       "2 bytes, 2 players",
+			rules:      &Rules{Scoring: singles, ScoreToWin: 300, ScoreIncrement: 100, ScoreWidth: 2},
+			numPlayers: 2,
+			maxScore:   9,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.rules.maxScore(); got != tc.maxScore {
+				t.Fatalf("highest score %d, expected %d", got, tc.maxScore)
+			}
+			numStates := calcNumDistinctStates(tc.rules, tc.numPlayers)
+			seen := make([]bool, numStates)
+			forEachGameState(tc.rules, tc.numPlayers, func(gs GameState) {
+				id := gs.ID(tc.rules)
+				if id < 0 || id >= numStates {
+					t.Fatalf("state %v: ID %d out of range [0, %d)", gs, id, numStates)
+				}
+				if seen[id] {
+					t.Fatalf("state %v: duplicate ID %d", gs, id)
+				}
+				seen[id] = true
+
+				buf := gs.ToBytes(tc.rules)
+				if len(buf) != sizeOfGameState(tc.rules, tc.numPlayers) {
+					t.Fatalf("state %v: serialized to %d bytes, expected %d",
+						gs, len(buf), sizeOfGameState(tc.rules, tc.numPlayers))
+				}
+				if got := GameStateFromBytes(tc.rules, buf); got != gs {
+					t.Fatalf("state %v: round-trip gave %v", gs, got)
+				}
+			})
+		})
+	}
+}
+
+func TestSizeOfGameState(t *testing.T) {
+	testCases := []struct {
+		scoreWidth int
+		numPlayers int
+		want       int
+	}{
+		{1, 1, 5},
+		{1, 2, 6},
+		{1, 4, 8},
+		{2, 1, 7},
+		{2, 2, 9},
+		{2, 4, 13},
+	}
+
+	for _, tc := range testCases {
+		rules := &Rules{Scoring: StandardScoring, ScoreWidth: tc.scoreWidth}
+		if got := sizeOfGameState(rules, tc.numPlayers); got != tc.want {
+			t.Errorf("%d-byte scores, %d players: size %d, expected %d",
+				tc.scoreWidth, tc.numPlayers, got, tc.want)
+		}
+	}
+}
@@ -2,14 +2,18 @@ package farkle
 
 import (
 	"bufio"
+	"context"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
 	"iter"
 	"math"
 	"os"
 	"runtime"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/bsm/extsort"
 	"github.com/golang/glog"
@@ -35,77 +39,110 @@ func (a Action) String() string {
 	return fmt.Sprintf("{Held: %s, %s}", roll, contStr)
 }
 
-func ApplyAction(state GameState, action Action) GameState {
-	trickScore := scoreCache[action.HeldDiceID]
-	newScore := state.ScoreThisRound + trickScore
-	if newScore < state.ScoreThisRound {
-		newScore = math.MaxUint8 // Overflow
+// The dice held.
+func (a Action) Held() Roll {
+	return rollsByID[a.HeldDiceID]
+}
+
+// JSON form of an Action, with the held dice written as in ParseRoll.
+type actionJSON struct {
+	Held            Roll `json:"held"`
+	ContinueRolling bool `json:"continue_rolling"`
+}
+
+func (a Action) MarshalJSON() ([]byte, error) {
+	return json.Marshal(actionJSON{
+		Held:            a.Held(),
+		ContinueRolling: a.ContinueRolling,
+	})
+}
+
+func (a *Action) UnmarshalJSON(data []byte) error {
+	var aj actionJSON
+	if err := json.Unmarshal(data, &aj); err != nil {
+		return err
 	}
-	state.ScoreThisRound = newScore
-	if trickScore == 0 { // Farkle
-		state.ScoreThisRound = 0
+	*a = Action{HeldDiceID: GetRollID(aj.Held), ContinueRolling: aj.ContinueRolling}
+	return nil
+}
+
+func ApplyAction(rules *Rules, state GameState, action Action) GameState {
+	if rollNumDice[action.HeldDiceID] > state.NumDiceToRoll {
+		panic(illegalActionError(action, rules.FormatState(state), state.NumDiceToRoll))
 	}
+	n := state.NumPlayers
+	applyAction(rules, &state.ScoreThisRound, &state.NumDiceToRoll,
+		state.PlayerScores[:n], state.ConsecutiveFarkles[:n], action)
+	return state
+}
 
-	numDiceHeld := rollNumDice[action.HeldDiceID]
-	if numDiceHeld > state.NumDiceToRoll {
-		panic(fmt.Errorf("illegal action %+v applied to state %+v: "+
-			"held %d dice but only had %d to roll",
-			action, state, numDiceHeld, state.NumDiceToRoll))
+func illegalActionError(action Action, state string, numDiceToRoll uint8) error {
+	return fmt.Errorf("illegal action %v applied to state %s: "+
+		"held %d dice but only had %d to roll",
+		action, state, rollNumDice[action.HeldDiceID], numDiceToRoll)
+}
+
+// Apply an action to the fields of a GameState or Table. If the current
+// player banks, the scores are rotated so that the next player is player 0.
+func applyAction(rules *Rules, scoreThisRound *uint16, numDiceToRoll *uint8,
+	playerScores []uint16, consecutiveFarkles []uint8, action Action) {
+	trickScore := rules.heldScore(action.HeldDiceID)
+	*scoreThisRound = addScores(rules, *scoreThisRound, trickScore)
+	if trickScore == 0 { // Farkle
+		*scoreThisRound = 0
 	}
-	state.NumDiceToRoll -= numDiceHeld
-	if state.NumDiceToRoll == 0 {
-		state.NumDiceToRoll = MaxNumDice
+
+	*numDiceToRoll -= rollNumDice[action.HeldDiceID]
+	if *numDiceToRoll == 0 {
+		*numDiceToRoll = MaxNumDice
 	}
 
 	if !action.ContinueRolling {
-		currentScore := state.PlayerScores[0]
-		newScore := currentScore + state.ScoreThisRound
-		if newScore < currentScore {
-			newScore = math.MaxUint8 // Overflow
+		newScore := addScores(rules, playerScores[0], *scoreThisRound)
+
+		farkles := uint8(0)
+		if rules.FarklePenalty > 0 && trickScore == 0 {
+			farkles = consecutiveFarkles[0] + 1
+			if farkles == NumFarklesForPenalty {
+				newScore -= min(newScore, rules.farklePenalty())
+				farkles = 0
+			}
 		}
+
 		// Advance to next player by rotating the scores.
-		copy(state.PlayerScores[:state.NumPlayers], state.PlayerScores[1:state.NumPlayers])
-		state.PlayerScores[state.NumPlayers-1] = newScore
-		state.ScoreThisRound = 0
-		state.NumDiceToRoll = MaxNumDice
+		n := len(playerScores)
+		copy(playerScores, playerScores[1:])
+		playerScores[n-1] = newScore
+		copy(consecutiveFarkles, consecutiveFarkles[1:])
+		consecutiveFarkles[n-1] = farkles
+		*scoreThisRound = 0
+		*numDiceToRoll = MaxNumDice
 	}
-
-	return state
 }
 
 // Find the action that maximizes current player win probability.
-func SelectAction(state GameState, rollID uint16, db DB) (Action, [maxNumPlayers]float64) {
+func SelectAction(rules *Rules, state GameState, rollID uint16, db DB) (Action, [maxNumPlayers]float64) {
 	var bestWinProb [maxNumPlayers]float64
 	var bestAction Action
-	notYetOnBoard := (state.PlayerScores[0] == 0)
-	potentialActions := rollIDToPotentialActions[rollID]
+	found := false
+	potentialActions := rules.Scoring.getTables().potentialActions[rollID]
 	for _, action := range potentialActions {
-		if state.ScoreThisRound == math.MaxUint8 && action.ContinueRolling {
-			// Overflowed score this round. Our assumption is that this is unlikely.
-			// Approximate the solution using the probability as if they stopped.
-			action.ContinueRolling = false
-		}
-
-		newState := ApplyAction(state, action)
-		if notYetOnBoard && !action.ContinueRolling && newState.PlayerScores[state.NumPlayers-1] < 500/incr {
-			// Not a valid state: You must get at least 500 to get on the board.
+		action, pSubtree, ok := evaluateAction(rules, state, action, db)
+		if !ok {
 			continue
 		}
-
-		pSubtree := db.Get(newState)
-		if !action.ContinueRolling {
-			// Probabilities are rotated since we advanced to the
-			// next player in next state.
-			pSubtree = unrotate(pSubtree, state.NumPlayers)
-		}
-		if pSubtree[0] > bestWinProb[0] {
+		// Every action may have no chance of winning, e.g. if the best
+		// the player can do is tie and ties lose, so the first legal
+		// action is chosen even then.
+		if !found || pSubtree[0] > bestWinProb[0] {
 			bestWinProb = pSubtree
 			bestAction = action
+			found = true
 		}
 	}
 
 	if len(potentialActions) == 0 {
-		newState := ApplyAction(state, bestAction)
+		newState := ApplyAction(rules, state, bestAction)
 		pSubtree := db.Get(newState)
 		bestWinProb = unrotate(pSubtree, state.NumPlayers)
 	}
@@ -113,6 +150,103 @@ func SelectAction(state GameState, rollID uint16, db DB) (Action, [maxNumPlayers
 	return bestAction, bestWinProb
 }
 
+// RankedAction is a legal action and its value.
+type RankedAction struct {
+	Action
+	// Win probability of each player if this action is taken,
+	// from the perspective of the player taking it.
+	WinProb [maxNumPlayers]float64
+	// Difference between the current player's win probability
+	// with this action and with the best action, always <= 0.
+	Delta float64
+}
+
+type RankedActions []RankedAction
+
+// All distinct legal actions for the given roll, sorted by the current
+// player's win probability, best first. The first action is the one
+// chosen by SelectAction. If the roll is a farkle, the only action is
+// the zero Action.
+//
+// Stopping is not a legal action for a player who would not get on
+// the board, so they are forced to continue rolling. If the score this
+// round has overflowed, continuing is approximated as stopping.
+func RankActions(rules *Rules, state GameState, rollID uint16, db DB) RankedActions {
+	potentialActions := rules.Scoring.getTables().potentialActions[rollID]
+	if len(potentialActions) == 0 {
+		_, pWin := SelectAction(rules, state, rollID, db)
+		return RankedActions{{WinProb: pWin}}
+	}
+
+	result := make(RankedActions, 0, len(potentialActions))
+	seen := make(map[Action]bool, len(potentialActions))
+	for _, action := range potentialActions {
+		action, pWin, ok := evaluateAction(rules, state, action, db)
+		if !ok || seen[action] {
+			// The same dice may be held as different combinations of tricks.
+			continue
+		}
+		seen[action] = true
+		result = append(result, RankedAction{Action: action, WinProb: pWin})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].WinProb[0] > result[j].WinProb[0]
+	})
+	for i := range result {
+		result[i].Delta = result[i].WinProb[0] - result[0].WinProb[0]
+	}
+	return result
+}
+
+// The ranking of the given action, or false if it is not legal.
+// An action that continues rolling after the score this round has
+// overflowed matches the equivalent action that stops.
+func (ranked RankedActions) Find(action Action) (RankedAction, bool) {
+	for _, ra := range ranked {
+		if ra.Action == action {
+			return ra, true
+		}
+	}
+
+	if action.ContinueRolling {
+		action.ContinueRolling = false
+		for _, ra := range ranked {
+			if ra.Action == action {
+				return ra, true
+			}
+		}
+	}
+
+	return RankedAction{}, false
+}
+
+// The action actually taken and the win probabilities of all players
+// (from the current player's perspective) if the given action is chosen,
+// or false if the action may not be taken in this state.
+func evaluateAction(rules *Rules, state GameState, action Action, db DB) (Action, [maxNumPlayers]float64, bool) {
+	if state.ScoreThisRound == rules.maxScore() && action.ContinueRolling {
+		// Overflowed score this round. Our assumption is that this is unlikely.
+		// Approximate the solution using the probability as if they stopped.
+		action.ContinueRolling = false
+	}
+
+	if !action.ContinueRolling && !rules.CanStop(state, action.HeldDiceID) {
+		// Not a valid state: You must get at least the minimum
+		// opening score to get on the board.
+		return action, [maxNumPlayers]float64{}, false
+	}
+
+	newState := ApplyAction(rules, state, action)
+	pSubtree := db.Get(newState)
+	if !action.ContinueRolling {
+		// Probabilities are rotated since we advanced to the
+		// next player in next state.
+		pSubtree = unrotate(pSubtree, state.NumPlayers)
+	}
+	return action, pSubtree, true
+}
+
 func unrotate(pWin [maxNumPlayers]float64, numPlayers uint8) [maxNumPlayers]float64 {
 	var result [maxNumPlayers]float64
 	copy(result[1:numPlayers], pWin[:numPlayers])
@@ -120,7 +254,8 @@ func unrotate(pWin [maxNumPlayers]float64, numPlayers uint8) [maxNumPlayers]floa
 	return result
 }
 
-var rollIDToPotentialActions = func() [][]Action {
+// For each roll ID, all actions that may be taken given the potential holds.
+func makePotentialActions(rollIDToPotentialHolds [][]Roll) [][]Action {
 	result := make([][]Action, len(rollIDToPotentialHolds))
 	for rollID, holds := range rollIDToPotentialHolds {
 		actions := make([]Action, 0, 2*len(holds))
@@ -137,101 +272,213 @@ var rollIDToPotentialActions = func() [][]Action {
 	}
 
 	return result
-}()
+}
+
+// Statistics from one value iteration cycle of UpdateAll.
+type UpdateStats struct {
+	// Number of game states that were updated.
+	NumStates int
+	// Number of game states whose value changed.
+	NumChanged int
+	// Largest change in the win probability of any player in any state.
+	MaxResidual float64
+	// Sum over all states of the largest change in win probability of any player.
+	SumResidual float64
+	// Time taken to update all states.
+	Elapsed time.Duration
+}
+
+// Mean over all states of the largest change in win probability of any player.
+func (s UpdateStats) MeanResidual() float64 {
+	if s.NumStates == 0 {
+		return 0
+	}
+	return s.SumResidual / float64(s.NumStates)
+}
+
+func (s UpdateStats) StatesPerSecond() float64 {
+	return float64(s.NumStates) / s.Elapsed.Seconds()
+}
+
+func (s UpdateStats) String() string {
+	return fmt.Sprintf(
+		"NumStates=%d, NumChanged=%d, MaxResidual=%g, MeanResidual=%g, StatesPerSecond=%.0f",
+		s.NumStates, s.NumChanged, s.MaxResidual, s.MeanResidual(), s.StatesPerSecond())
+}
+
+// Combine the statistics of two partial updates.
+func (s *UpdateStats) Add(other UpdateStats) {
+	s.NumStates += other.NumStates
+	s.NumChanged += other.NumChanged
+	s.MaxResidual = max(s.MaxResidual, other.MaxResidual)
+	s.SumResidual += other.SumResidual
+	s.Elapsed += other.Elapsed
+}
+
+// Record the update of a state from oldValue to newValue.
+func (s *UpdateStats) observe(oldValue, newValue [maxNumPlayers]float64) {
+	residual := 0.0
+	for i := range oldValue {
+		residual = max(residual, math.Abs(newValue[i]-oldValue[i]))
+	}
+
+	s.NumStates++
+	if residual > 0 {
+		s.NumChanged++
+	}
+	s.MaxResidual = max(s.MaxResidual, residual)
+	s.SumResidual += residual
+}
+
+// Called by UpdateAll once all states with the given depth (and therefore
+// all deeper states) have been updated, with the statistics so far.
+type DepthCallback func(depth uint16, stats UpdateStats) error
+
+// Number of game states sent to an update worker at a time.
+const updateChunkSize = 64
 
 // Recalculate the value of all states in the given iterator,
 // updating the value of each state in the database.
-func UpdateAll(db DB, states iter.Seq2[uint16, GameState]) {
-	// Recalculate all other states.
-	var mx sync.RWMutex
+//
+// States with the same depth are updated in parallel. If the database is a
+// ConcurrentDB, each worker writes its results directly to the database as
+// they are calculated. Otherwise, workers share a lock that is held for
+// reading while calculating values and for writing while storing them.
+//
+// If the context is canceled, UpdateAll stops once the states in progress
+// have been updated, and returns the statistics of all completed depths
+// along with the context's error. If onDepthDone is non-nil, it is called
+// after each depth is completed and any error it returns stops the update.
+func UpdateAll(ctx context.Context, rules *Rules, db DB, states iter.Seq2[uint16, GameState], onDepthDone DepthCallback) (UpdateStats, error) {
+	start := time.Now()
+	var stats, completed UpdateStats
+	var statsMx sync.Mutex
+
+	var mx *sync.RWMutex
+	if _, ok := db.(ConcurrentDB); !ok {
+		mx = new(sync.RWMutex)
+	}
+
 	var wg sync.WaitGroup
-	var workCh chan GameState
+	var workCh chan []GameState
 	numWorkers := runtime.NumCPU()
 	currentDepth := uint16(0)
-	for depth, state := range states {
-		if depth != currentDepth {
-			// Wait for previous depth to complete.
+	chunk := make([]GameState, 0, updateChunkSize)
+	sendChunk := func() bool {
+		if len(chunk) == 0 {
+			return true
+		}
+		select {
+		case workCh <- chunk:
+			chunk = make([]GameState, 0, updateChunkSize)
+			return true
+		case <-ctx.Done():
 			close(workCh)
 			wg.Wait()
+			return false
+		}
+	}
+	finishDepth := func() error {
+		close(workCh)
+		wg.Wait()
+		completed = stats
+		completed.Elapsed = time.Since(start)
+		if onDepthDone != nil {
+			return onDepthDone(currentDepth, completed)
+		}
+		return nil
+	}
+
+	for depth, state := range states {
+		if workCh == nil || depth != currentDepth {
+			if workCh != nil {
+				// Wait for previous depth to complete.
+				if !sendChunk() {
+					return completed, ctx.Err()
+				}
+				if err := finishDepth(); err != nil {
+					return completed, err
+				}
+			}
 
 			// Start up workers for next depth.
+			currentDepth = depth
 			glog.Infof("Processing game states with depth=%d", depth)
-			workCh = make(chan GameState, numWorkers)
+			workCh = make(chan []GameState, numWorkers)
 			wg.Add(numWorkers)
 			for i := 0; i < numWorkers; i++ {
 				go func() {
-					updateWorker(db, workCh, &mx)
+					workerStats := updateWorker(rules, db, workCh, mx)
+					statsMx.Lock()
+					stats.Add(workerStats)
+					statsMx.Unlock()
 					wg.Done()
 				}()
 			}
 		}
 
-		workCh <- state
+		chunk = append(chunk, state)
+		if len(chunk) == updateChunkSize && !sendChunk() {
+			return completed, ctx.Err()
+		}
 	}
 
-	close(workCh)
-	wg.Wait()
-}
-
-func updateWorker(db DB, workCh <-chan GameState, mx *sync.RWMutex) {
-	// We batch updates to the database to reduce lock contention.
-	batchSize := 1024 // Arbitrary, tunable
-	batchStates := make([]GameState, batchSize)
-	batchUpdates := make([][maxNumPlayers]float64, batchSize)
-	for state := range workCh {
-		var pWin [maxNumPlayers]float64
-		if state.IsGameOver() {
-			pWin = calcEndGameValue(state)
-		} else {
-			mx.RLock()
-			pWin = calcStateValue(state, db)
-			mx.RUnlock()
+	if workCh != nil {
+		if !sendChunk() {
+			return completed, ctx.Err()
 		}
-
-		batchStates = append(batchStates, state)
-		batchUpdates = append(batchUpdates, pWin)
-		if len(batchStates) == cap(batchStates) {
-			mx.Lock()
-			for i, state := range batchStates {
-				db.Put(state, batchUpdates[i])
-			}
-			mx.Unlock()
-			batchStates = batchStates[:0]
-			batchUpdates = batchUpdates[:0]
+		if err := finishDepth(); err != nil {
+			return completed, err
 		}
 	}
 
-	mx.Lock()
-	defer mx.Unlock()
-	for i, state := range batchStates {
-		db.Put(state, batchUpdates[i])
-	}
+	return completed, nil
 }
 
-func calcEndGameValue(state GameState) [maxNumPlayers]float64 {
-	winningScore := state.HighestScore()
-	winners := make([]int, 0, maxNumPlayers)
-	for player, score := range state.PlayerScores[:state.NumPlayers] {
-		if score == winningScore {
-			winners = append(winners, player)
+// Update the value of each chunk of states received from workCh.
+// If mx is nil, the database must be a ConcurrentDB.
+func updateWorker(rules *Rules, db DB, workCh <-chan []GameState, mx *sync.RWMutex) UpdateStats {
+	var stats UpdateStats
+	updates := make([][maxNumPlayers]float64, updateChunkSize)
+	for states := range workCh {
+		if mx == nil {
+			for _, state := range states {
+				pWin := calcValue(rules, state, db)
+				stats.observe(db.Get(state), pWin)
+				db.Put(state, pWin)
+			}
+			continue
+		}
+
+		// Each chunk is written as a batch to reduce lock contention.
+		mx.RLock()
+		for i, state := range states {
+			updates[i] = calcValue(rules, state, db)
+			stats.observe(db.Get(state), updates[i])
 		}
-	}
+		mx.RUnlock()
 
-	// Not clear how ties should be considered in terms of "win probability".
-	// We split the win amongst all players with the same score.
-	p := 1.0 / float64(len(winners))
-	var result [maxNumPlayers]float64
-	for _, winner := range winners {
-		result[winner] = p
+		mx.Lock()
+		for i, state := range states {
+			db.Put(state, updates[i])
+		}
+		mx.Unlock()
 	}
 
-	return result
+	return stats
+}
+
+func calcValue(rules *Rules, state GameState, db DB) [maxNumPlayers]float64 {
+	if state.IsGameOver(rules) {
+		return calcEndGameValue(rules, state)
+	}
+	return calcStateValue(rules, state, db)
 }
 
-func calcStateValue(state GameState, db DB) [maxNumPlayers]float64 {
+func calcStateValue(rules *Rules, state GameState, db DB) [maxNumPlayers]float64 {
 	var pWin [maxNumPlayers]float64
 	for _, wRoll := range allRolls[state.NumDiceToRoll] {
-		_, pSubgame := SelectAction(state, wRoll.ID, db)
+		_, pSubgame := SelectAction(rules, state, wRoll.ID, db)
 		for i, p := range pSubgame[:state.NumPlayers] {
 			pWin[i] += wRoll.Prob * p
 		}
@@ -240,8 +487,10 @@ func calcStateValue(state GameState, db DB) [maxNumPlayers]float64 {
 	return pWin
 }
 
-// Save all game states from the given iterator to a file.
-func SaveGameStates(states iter.Seq2[uint16, GameState], path string) error {
+// Save all game states from the given iterator to a file. The file starts
+// with a header recording the rules and number of players, followed by
+// each state with its depth, serialized with the score width of the rules.
+func SaveGameStates(rules *Rules, numPlayers int, states iter.Seq2[uint16, GameState], path string) error {
 	f, err := os.Create(path)
 	if err != nil {
 		return err
@@ -250,12 +499,21 @@ func SaveGameStates(states iter.Seq2[uint16, GameState], path string) error {
 	w := bufio.NewWriterSize(f, 4*1024*1024)
 
 	glog.Infof("Saving game states to: %s", path)
-	buf := make([]byte, maxSizeOfGameState+2)
+	header := newGameStatesHeader(rules, numPlayers)
+	headerBytes, err := header.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(headerBytes); err != nil {
+		return err
+	}
+
+	buf := make([]byte, sizeOfGameState(rules, maxNumPlayers)+2)
 	i := 0
 	for depth, state := range states {
 		binary.LittleEndian.PutUint16(buf[:2], depth)
-		n := state.SerializeTo(buf[1:])
-		if _, err := w.Write(buf[:n+1]); err != nil {
+		n := state.SerializeTo(rules, buf[2:])
+		if _, err := w.Write(buf[:n+2]); err != nil {
 			return err
 		}
 
@@ -272,18 +530,41 @@ func SaveGameStates(states iter.Seq2[uint16, GameState], path string) error {
 	return f.Close()
 }
 
-// Return an iterator over all game states in the given file.
-func IterGameStates(numPlayers int, path string) (iter.Seq2[uint16, GameState], error) {
+// Header of a file of the game states with the given rules and number of players.
+func newGameStatesHeader(rules *Rules, numPlayers int) DBHeader {
+	header := newDBHeader(rules, numPlayers, Float64Encoding)
+	header.Kind = SortedStateList
+	return header
+}
+
+// Return an iterator over all game states in the given file, which
+// must have been saved with the same rules and number of players.
+func IterGameStates(rules *Rules, numPlayers int, path string) (iter.Seq2[uint16, GameState], error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 
+	r := bufio.NewReaderSize(f, 4*1024*1024)
+	headerBytes := make([]byte, dbHeaderSize)
+	var header DBHeader
+	if _, err := io.ReadFull(r, headerBytes); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: error reading game states header: %w", path, err)
+	}
+	if err := header.UnmarshalBinary(headerBytes); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := header.checkCompatible(newGameStatesHeader(rules, numPlayers)); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
 	return func(yield func(uint16, GameState) bool) {
 		defer f.Close()
-		r := bufio.NewReaderSize(f, 4*1024*1024)
 
-		buf := make([]byte, numPlayers+3+2)
+		buf := make([]byte, sizeOfGameState(rules, numPlayers)+2)
 		for {
 			_, err := io.ReadFull(r, buf)
 			if err == io.EOF {
@@ -293,7 +574,7 @@ func IterGameStates(numPlayers int, path string) (iter.Seq2[uint16, GameState],
 			}
 
 			depth := binary.LittleEndian.Uint16(buf[:2])
-			state := GameStateFromBytes(buf[2:])
+			state := GameStateFromBytes(rules, buf[2:])
 			if !yield(depth, state) {
 				break
 			}
@@ -304,7 +585,7 @@ func IterGameStates(numPlayers int, path string) (iter.Seq2[uint16, GameState],
 // Return an iterator over all distinct game states and their depth in the game tree.
 // Game states are sorted by depth in descending order such that end game states
 // are enumerated before early game states.
-func SortedGameStates(numPlayers int, workDir string) iter.Seq2[uint16, GameState] {
+func SortedGameStates(rules *Rules, numPlayers int, workDir string) iter.Seq2[uint16, GameState] {
 	sorter := extsort.New(&extsort.Options{
 		WorkDir:    workDir,
 		Compare:    compareGameStateDepth,
@@ -312,17 +593,17 @@ func SortedGameStates(numPlayers int, workDir string) iter.Seq2[uint16, GameStat
 	})
 
 	glog.Infof("Enumerating all %d %d-player game states",
-		calcNumDistinctStates(numPlayers), numPlayers)
+		calcNumDistinctStates(rules, numPlayers), numPlayers)
 	i := 0
-	for depth, gs := range allGameStates(numPlayers) {
+	for depth, gs := range allGameStates(rules, numPlayers) {
 		if depth > math.MaxUint16 {
 			panic(fmt.Errorf("game state has depth %d > max uint8", depth))
 		}
 
 		key := make([]byte, 2)
 		binary.LittleEndian.PutUint16(key, uint16(depth))
-		value := make([]byte, numPlayers+3)
-		n := gs.SerializeTo(value)
+		value := make([]byte, sizeOfGameState(rules, numPlayers))
+		n := gs.SerializeTo(rules, value)
 		sorter.Put(key, value[:n])
 
 		i++
@@ -340,7 +621,7 @@ func SortedGameStates(numPlayers int, workDir string) iter.Seq2[uint16, GameStat
 	return func(yield func(uint16, GameState) bool) {
 		for iter.Next() {
 			depth := binary.LittleEndian.Uint16(iter.Key())
-			state := GameStateFromBytes(iter.Value())
+			state := GameStateFromBytes(rules, iter.Value())
 			if !yield(depth, state) {
 				break
 			}
@@ -371,51 +652,69 @@ func compareGameStateDepth(d1, d2 []byte) int {
 	return 1
 }
 
+// Return an iterator over all distinct game states that can be reached
+// under the given rules, in no particular order. Unlike SortedGameStates,
+// states are streamed as they are found.
+func ReachableGameStates(rules *Rules, numPlayers int) iter.Seq[GameState] {
+	return func(yield func(GameState) bool) {
+		for _, state := range allGameStates(rules, numPlayers) {
+			if !yield(state) {
+				return
+			}
+		}
+	}
+}
+
 // Return an iterator over all distinct game states, and their minimum
 // depth in the game tree.
-func allGameStates(numPlayers int) iter.Seq2[int, GameState] {
+func allGameStates(rules *Rules, numPlayers int) iter.Seq2[int, GameState] {
+	if err := checkNumSolvedPlayers(rules, numPlayers); err != nil {
+		panic(err)
+	}
+
 	return func(yield func(int, GameState) bool) {
 		initialState := NewGameState(numPlayers)
-		mask := newBitMask(calcNumDistinctStates(numPlayers))
-		recursiveEnumerateStates(initialState, mask, 0, yield)
+		mask := newBitMask(calcNumDistinctStates(rules, numPlayers))
+		recursiveEnumerateStates(rules, initialState, mask, 0, yield)
 	}
 }
 
-func recursiveEnumerateStates(state GameState, mask *bitMask, depth int, yield func(int, GameState) bool) bool {
-	gsID := state.ID()
+func recursiveEnumerateStates(rules *Rules, state GameState, mask *bitMask, depth int, yield func(int, GameState) bool) bool {
+	gsID := state.ID(rules)
 	if mask.IsSet(gsID) {
 		return true
 	}
 
 	mask.Set(gsID)
-	if state.IsGameOver() {
+	if state.IsGameOver(rules) {
 		return yield(depth, state)
 	}
 
-	notYetOnBoard := (state.PlayerScores[0] == 0)
 	for _, wRoll := range allRolls[state.NumDiceToRoll] {
-		potentialActions := rollIDToPotentialActions[wRoll.ID]
+		potentialActions := rules.Scoring.getTables().potentialActions[wRoll.ID]
 		for _, action := range potentialActions {
-			if state.ScoreThisRound == math.MaxUint8 && action.ContinueRolling {
+			if state.ScoreThisRound == rules.maxScore() && action.ContinueRolling {
 				// Overflowed score this round. Our assumption is that this is unlikely.
 				// Approximate the solution using the probability as if they stopped.
 				action.ContinueRolling = false
 			}
 
-			newState := ApplyAction(state, action)
-			if notYetOnBoard && !action.ContinueRolling && newState.PlayerScores[state.NumPlayers-1] < 500/incr {
-				// Not a valid state: You must get at least 500 to get on the board.
+			if !action.ContinueRolling && !rules.CanStop(state, action.HeldDiceID) {
+				// Not a valid state: You must get at least the minimum
+				// opening score to get on the board.
 				continue
 			}
 
-			if !recursiveEnumerateStates(newState, mask, depth+1, yield) {
+			newState := ApplyAction(rules, state, action)
+
+			if !recursiveEnumerateStates(rules, newState, mask, depth+1, yield) {
 				return false
 			}
 		}
 
 		if len(potentialActions) == 0 {
-			newState := ApplyAction(state, Action{})
-			if !recursiveEnumerateStates(newState, mask, depth+1, yield) {
+			newState := ApplyAction(rules, state, Action{})
+			if !recursiveEnumerateStates(rules, newState, mask, depth+1, yield) {
 				return false
 			}
 		}
@@ -423,9 +722,3 @@ func recursiveEnumerateStates(state GameState, mask *bitMask, depth int, yield f
 
 	return yield(depth, state)
 }
-
-func init() {
-	if scoreCache[0] != 0 {
-		panic(fmt.Errorf("farkle should have zero score! got %d", scoreCache[0]))
-	}
-}
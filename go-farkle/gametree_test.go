@@ -0,0 +1,221 @@
+package farkle
+
+import (
+	"context"
+	"iter"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Write the sorted game states of a game small enough
+// to solve in a test to a file.
+func gameStatesFile(t testing.TB, rules *Rules, numPlayers int) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.games")
+	states := SortedGameStates(rules, numPlayers, dir)
+	if err := SaveGameStates(rules, numPlayers, states, path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func iterGameStatesFile(t testing.TB, rules *Rules, numPlayers int, path string) iter.Seq2[uint16, GameState] {
+	t.Helper()
+	states, err := IterGameStates(rules, numPlayers, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return states
+}
+
+func TestIterGameStatesChecksGame(t *testing.T) {
+	path := gameStatesFile(t, tinyRules, tinyNumPlayers)
+	otherRules := *tinyRules
+	otherRules.ScoreToWin = 200
+
+	testCases := []struct {
+		name       string
+		rules      *Rules
+		numPlayers int
+		wantErr    string
+	}{
+		{"same game", tinyRules, tinyNumPlayers, ""},
+		{"different rules", &otherRules, tinyNumPlayers, "scores"},
+		{"different players", tinyRules, 3, "players"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			states, err := IterGameStates(tc.rules, tc.numPlayers, path)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				n := 0
+				for range states {
+					n++
+				}
+				if n == 0 {
+					t.Errorf("no game states read")
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %v, expected one about %s", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// Solve the game with the given states until it converges.
+func solveGame(t *testing.T, rules *Rules, numPlayers int, db DB, statesPath string) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		stats, err := UpdateAll(context.Background(), rules, db,
+			iterGameStatesFile(t, rules, numPlayers, statesPath), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.MaxResidual < 1e-10 {
+			return
+		}
+	}
+	t.Fatal("game did not converge")
+}
+
+// lockedDB hides the ConcurrentDB implementation of the wrapped DB,
+// so that UpdateAll falls back to a shared lock.
+type lockedDB struct {
+	DB
+}
+
+// Compare the throughput of value iteration with and without a shared
+// lock around the database.
+func BenchmarkUpdateAll(b *testing.B) {
+	statesPath := tinyGameStates(b)
+	for _, locked := range []bool{true, false} {
+		name := "concurrent"
+		if locked {
+			name = "locked"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			var db DB = NewMemDB(tinyRules, tinyNumPlayers)
+			if locked {
+				db = lockedDB{db}
+			}
+
+			var total UpdateStats
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				stats, err := UpdateAll(context.Background(), tinyRules, db,
+					iterTinyGameStates(b, statesPath), nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				total.Add(stats)
+			}
+			b.ReportMetric(float64(total.NumStates)/b.Elapsed().Seconds(), "states/s")
+		})
+	}
+}
+
+// bankedDB values every player by their banked score in units of
+// 1/1000, and the current player's score this round at a quarter
+// of that, so that banking more is always better than rolling on.
+type bankedDB struct {
+	numPlayers int
+}
+
+func (db bankedDB) NumPlayers() int                       { return db.numPlayers }
+func (db bankedDB) Put(GameState, [maxNumPlayers]float64) {}
+func (db bankedDB) Close() error                          { return nil }
+
+func (db bankedDB) Get(state GameState) [maxNumPlayers]float64 {
+	var pWin [maxNumPlayers]float64
+	for i, score := range state.PlayerScores[:state.NumPlayers] {
+		pWin[i] = float64(score) / 1000
+	}
+	pWin[0] += float64(state.ScoreThisRound) / 4000
+	return pWin
+}
+
+func TestRankActions(t *testing.T) {
+	rules := &Rules{Scoring: StandardScoring, ScoreToWin: 10000}
+	db := bankedDB{numPlayers: 2}
+	state := NewGameState(2)
+	state.PlayerScores = [maxNumPlayers]uint16{20, 40}
+	state.NumDiceToRoll = 3
+	hold := func(dice ...uint8) uint16 { return GetRollID(NewRoll(dice...)) }
+
+	// Three 1s may also be held as three single 1s, but each
+	// distinct action is only listed once.
+	ranked := RankActions(rules, state, GetRollID(NewRoll(1, 1, 1)), db)
+	expected := []struct {
+		action Action
+		delta  float64
+	}{
+		{Action{HeldDiceID: hold(1, 1, 1)}, 0},
+		{Action{HeldDiceID: hold(1, 1)}, -0.002},
+		{Action{HeldDiceID: hold(1)}, -0.004},
+		{Action{HeldDiceID: hold(1, 1, 1), ContinueRolling: true}, -0.0045},
+		{Action{HeldDiceID: hold(1, 1), ContinueRolling: true}, -0.005},
+		{Action{HeldDiceID: hold(1), ContinueRolling: true}, -0.0055},
+	}
+	if len(ranked) != len(expected) {
+		t.Fatalf("got %d actions, expected %d: %v", len(ranked), len(expected), ranked)
+	}
+	for i, e := range expected {
+		if ranked[i].Action != e.action || math.Abs(ranked[i].Delta-e.delta) > 1e-12 {
+			t.Errorf("action %d: got %v with delta %v, expected %v with delta %v",
+				i, ranked[i].Action, ranked[i].Delta, e.action, e.delta)
+		}
+	}
+	if selected, _ := SelectAction(rules, state, GetRollID(NewRoll(1, 1, 1)), db); selected != ranked[0].Action {
+		t.Errorf("SelectAction chose %v, expected %v", selected, ranked[0].Action)
+	}
+
+	farkle := RankActions(rules, state, GetRollID(NewRoll(2, 3, 4)), db)
+	if len(farkle) != 1 || farkle[0].Action != (Action{}) {
+		t.Errorf("got %v after a farkle, expected only the zero action", farkle)
+	}
+}
+
+func TestRankedActionsFind(t *testing.T) {
+	rules := &Rules{Scoring: StandardScoring, ScoreToWin: 10000}
+	db := bankedDB{numPlayers: 2}
+	state := NewGameState(2)
+	state.NumDiceToRoll = 3
+	rollID := GetRollID(NewRoll(1, 1, 5))
+	held := GetRollID(NewRoll(1, 5))
+	overflowed := state
+	overflowed.ScoreThisRound = rules.maxScore()
+
+	testCases := []struct {
+		name   string
+		state  GameState
+		action Action
+		want   Action
+		wantOK bool
+	}{
+		{"stop", state, Action{HeldDiceID: held}, Action{HeldDiceID: held}, true},
+		{"continue", state, Action{HeldDiceID: held, ContinueRolling: true},
+			Action{HeldDiceID: held, ContinueRolling: true}, true},
+		{"continue after overflow", overflowed, Action{HeldDiceID: held, ContinueRolling: true},
+			Action{HeldDiceID: held}, true},
+		{"invalid hold", state, Action{HeldDiceID: GetRollID(NewRoll(5, 5))}, Action{}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := RankActions(rules, tc.state, rollID, db).Find(tc.action)
+			if ok != tc.wantOK || got.Action != tc.want {
+				t.Errorf("got %v, %v, expected %v, %v", got.Action, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
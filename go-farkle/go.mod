@@ -4,9 +4,9 @@ go 1.23.4
 
 require github.com/golang/glog v1.2.3
 
-require golang.org/x/sys v0.18.0
-
 require (
-	github.com/bsm/extsort v0.6.1 // indirect
-	github.com/klauspost/compress v1.16.3 // indirect
+	github.com/bsm/extsort v0.6.1
+	golang.org/x/sys v0.18.0
 )
+
+require github.com/klauspost/compress v1.16.3 // indirect
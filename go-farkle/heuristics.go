@@ -0,0 +1,234 @@
+package farkle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Heuristic strategies that do not need a solution database.
+// All of them hold the dice that score the most points, and only
+// differ in when they bank. They never bank when the rules do not
+// allow it, or in the final round when banking would lose the game.
+
+// Bank once the score this round is at least Threshold points.
+type ThresholdStrategy struct {
+	Rules     *Rules
+	Threshold int
+}
+
+func (s *ThresholdStrategy) ChooseAction(table Table, roll Roll) Action {
+	heldID := maxScoreHold(s.Rules, GetRollID(roll))
+	score := scoreAfterHold(s.Rules, table, heldID)
+	return heuristicAction(s.Rules, table, heldID, score >= s.Threshold)
+}
+
+// Bank once MinDice or fewer dice would be left to roll.
+type DiceStrategy struct {
+	Rules   *Rules
+	MinDice int
+}
+
+func (s *DiceStrategy) ChooseAction(table Table, roll Roll) Action {
+	heldID := maxScoreHold(s.Rules, GetRollID(roll))
+	newTable := ApplyTableAction(s.Rules, table, Action{HeldDiceID: heldID, ContinueRolling: true})
+	return heuristicAction(s.Rules, table, heldID, int(newTable.NumDiceToRoll) <= s.MinDice)
+}
+
+// Keep rolling as long as the expected points from the next roll exceed
+// the expected loss from farkling. Caution scales the expected loss:
+// 1 is neutral, values > 1 bank sooner and values < 1 bank later.
+type GreedyStrategy struct {
+	Rules   *Rules
+	Caution float64
+
+	once  sync.Once
+	stats [MaxNumDice + 1]rollStats
+}
+
+type rollStats struct {
+	// Probability of farkling.
+	pFarkle float64
+	// Expected points of the best hold, given that the roll is not a farkle.
+	meanScore float64
+}
+
+func (s *GreedyStrategy) ChooseAction(table Table, roll Roll) Action {
+	s.once.Do(func() {
+		for numDice := 1; numDice <= MaxNumDice; numDice++ {
+			s.stats[numDice] = calcRollStats(s.Rules, numDice)
+		}
+	})
+
+	heldID := maxScoreHold(s.Rules, GetRollID(roll))
+	score := scoreAfterHold(s.Rules, table, heldID)
+	newTable := ApplyTableAction(s.Rules, table, Action{HeldDiceID: heldID, ContinueRolling: true})
+	stats := s.stats[newTable.NumDiceToRoll]
+	expectedGain := (1 - stats.pFarkle) * stats.meanScore
+	expectedLoss := s.Caution * stats.pFarkle * float64(score)
+	return heuristicAction(s.Rules, table, heldID, expectedLoss >= expectedGain)
+}
+
+func calcRollStats(rules *Rules, numDice int) rollStats {
+	var stats rollStats
+	for _, wRoll := range allRolls[numDice] {
+		heldID := maxScoreHold(rules, wRoll.ID)
+		if heldID == 0 {
+			stats.pFarkle += wRoll.Prob
+			continue
+		}
+		stats.meanScore += wRoll.Prob * float64(rules.Scoring.getTables().points[heldID])
+	}
+	if stats.pFarkle < 1 {
+		stats.meanScore /= 1 - stats.pFarkle
+	}
+	return stats
+}
+
+// RollOdds describes the outcome of rolling a number of dice.
+type RollOdds struct {
+	// Probability of farkling.
+	PFarkle float64
+	// Expected points of the highest scoring hold, counting a farkle as 0.
+	ExpectedScore float64
+}
+
+// The odds of rolling the given number of dice.
+func CalcRollOdds(rules *Rules, numDice int) RollOdds {
+	stats := calcRollStats(rules, numDice)
+	return RollOdds{
+		PFarkle:       stats.pFarkle,
+		ExpectedScore: (1 - stats.pFarkle) * stats.meanScore,
+	}
+}
+
+// Like ThresholdStrategy, but when behind, the threshold is raised by
+// Aggression times the leading opponent's lead.
+type CatchUpStrategy struct {
+	Rules      *Rules
+	Threshold  int
+	Aggression float64
+}
+
+func (s *CatchUpStrategy) ChooseAction(table Table, roll Roll) Action {
+	heldID := maxScoreHold(s.Rules, GetRollID(roll))
+	score := scoreAfterHold(s.Rules, table, heldID)
+	lead := s.Rules.Points(table.HighestScore()) - s.Rules.Points(table.CurrentPlayerScore())
+	threshold := float64(s.Threshold) + s.Aggression*float64(lead)
+	return heuristicAction(s.Rules, table, heldID, float64(score) >= threshold)
+}
+
+// The dice to hold that score the most points, preferring to hold fewer
+// dice among equal scores, or 0 if the roll is a farkle.
+func maxScoreHold(rules *Rules, rollID uint16) uint16 {
+	tables := rules.Scoring.getTables()
+	bestID := uint16(0)
+	for _, action := range tables.potentialActions[rollID] {
+		heldID := action.HeldDiceID
+		if tables.points[heldID] > tables.points[bestID] ||
+			(tables.points[heldID] == tables.points[bestID] && rollNumDice[heldID] < rollNumDice[bestID]) {
+			bestID = heldID
+		}
+	}
+	return bestID
+}
+
+// Points accumulated this round after holding the given dice.
+func scoreAfterHold(rules *Rules, table Table, heldID uint16) int {
+	return rules.Points(table.ScoreThisRound) + rules.Scoring.getTables().points[heldID]
+}
+
+// The action that holds the given dice and banks if the strategy wants to
+// and it is allowed and sensible, or otherwise continues rolling.
+func heuristicAction(rules *Rules, table Table, heldID uint16, wantStop bool) Action {
+	action := Action{HeldDiceID: heldID, ContinueRolling: true}
+	if !table.CanStop(rules, heldID) {
+		return action
+	}
+	if table.ScoreThisRound == rules.maxScore() {
+		// Overflowed score this round, nothing more to gain.
+		action.ContinueRolling = false
+		return action
+	}
+	if !wantStop {
+		return action
+	}
+
+	// In the final round, banking no more than the leader cannot win.
+	leaderScore := uint16(0)
+	for _, score := range table.PlayerScores[1:table.NumPlayers] {
+		leaderScore = max(leaderScore, score)
+	}
+	newTable := ApplyTableAction(rules, table, Action{HeldDiceID: heldID})
+	newScore := newTable.PlayerScores[table.NumPlayers-1]
+	if leaderScore >= rules.scoreToWin() && newScore <= leaderScore {
+		return action
+	}
+
+	action.ContinueRolling = false
+	return action
+}
+
+// Names of the heuristic strategies accepted by NewHeuristicStrategy,
+// with their parameters.
+var HeuristicStrategyUsage = []string{
+	"threshold:<points>",
+	"dice:<min dice>",
+	"greedy[:<caution>]",
+	"catchup:<points>:<aggression>",
+}
+
+// Create a heuristic strategy from a specification such as "threshold:300".
+// See HeuristicStrategyUsage for the available strategies.
+func NewHeuristicStrategy(rules *Rules, spec string) (Strategy, error) {
+	name, args, _ := strings.Cut(spec, ":")
+	var params []float64
+	if args != "" {
+		for _, arg := range strings.Split(args, ":") {
+			v, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid parameter for %s strategy: %w", name, err)
+			}
+			params = append(params, v)
+		}
+	}
+
+	checkParams := func(min, max int) error {
+		if len(params) < min || len(params) > max {
+			return fmt.Errorf("%s strategy takes %d-%d parameters, got %d",
+				name, min, max, len(params))
+		}
+		return nil
+	}
+
+	switch name {
+	case "threshold":
+		if err := checkParams(1, 1); err != nil {
+			return nil, err
+		}
+		return &ThresholdStrategy{Rules: rules, Threshold: int(params[0])}, nil
+	case "dice":
+		if err := checkParams(1, 1); err != nil {
+			return nil, err
+		}
+		return &DiceStrategy{Rules: rules, MinDice: int(params[0])}, nil
+	case "greedy":
+		if err := checkParams(0, 1); err != nil {
+			return nil, err
+		}
+		s := &GreedyStrategy{Rules: rules, Caution: 1}
+		if len(params) > 0 {
+			s.Caution = params[0]
+		}
+		return s, nil
+	case "catchup":
+		if err := checkParams(2, 2); err != nil {
+			return nil, err
+		}
+		return &CatchUpStrategy{Rules: rules, Threshold: int(params[0]), Aggression: params[1]}, nil
+	default:
+		return nil, fmt.Errorf("unknown strategy %q, valid options: %s",
+			name, strings.Join(HeuristicStrategyUsage, ", "))
+	}
+}
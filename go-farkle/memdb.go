@@ -0,0 +1,179 @@
+package farkle
+
+import (
+	"bufio"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+const numMemDBShards = 64
+
+// DB that stores results in memory. Only game states that have been
+// Put are stored; all others have the initial value 1/numPlayers,
+// as in a newly initialized FileDB. It is safe for concurrent use.
+type MemDB struct {
+	rules      *Rules
+	numPlayers int
+	shards     [numMemDBShards]memDBShard
+}
+
+type memDBShard struct {
+	mx     sync.RWMutex
+	values map[int][maxNumPlayers]float64
+}
+
+func NewMemDB(rules *Rules, numPlayers int) *MemDB {
+	if err := checkNumSolvedPlayers(rules, numPlayers); err != nil {
+		panic(err)
+	}
+	db := &MemDB{
+		rules:      rules,
+		numPlayers: numPlayers,
+	}
+	for i := range db.shards {
+		db.shards[i].values = make(map[int][maxNumPlayers]float64)
+	}
+	return db
+}
+
+// Load a database saved in the FileDB format into memory.
+func LoadMemDB(path string) (*MemDB, error) {
+	header, err := ReadDBHeader(path)
+	if err != nil {
+		return nil, err
+	}
+	if header.Encoding != Float64Encoding {
+		return nil, fmt.Errorf("%s: cannot load %v encoded database into memory",
+			path, header.Encoding)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(dbHeaderSize, io.SeekStart); err != nil {
+		return nil, err
+	}
+	hash := crc32.New(crc32c)
+	r := bufio.NewReaderSize(io.TeeReader(f, hash), 4*1024*1024)
+
+	db := NewMemDB(header.Rules, header.NumPlayers)
+	initialValue := db.initialValue()
+	buf := make([]byte, 8*db.numPlayers)
+	numStates := calcNumDistinctStates(db.rules, db.numPlayers)
+	for gsID := 0; gsID < numStates; gsID++ {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("%s: error reading values: %w", path, err)
+		}
+
+		var pWin [maxNumPlayers]float64
+		for i := 0; i < db.numPlayers; i++ {
+			pWin[i] = Float64Encoding.decode(buf[8*i:])
+		}
+		if pWin != initialValue {
+			db.putID(gsID, pWin)
+		}
+	}
+
+	if _, err := r.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("%s is not the correct size for %d-player database",
+			path, db.numPlayers)
+	}
+	if header.Dirty {
+		glog.Warningf("%s was not closed cleanly, its checksum cannot be verified", path)
+	} else if got := hash.Sum32(); got != header.Checksum {
+		return nil, fmt.Errorf("%s: database checksum mismatch: got %08x, expected %08x",
+			path, got, header.Checksum)
+	}
+
+	return db, nil
+}
+
+// Save the database to a file in the FileDB format.
+func (db *MemDB) SaveTo(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := newDBHeader(db.rules, db.numPlayers, Float64Encoding)
+	numStates := calcNumDistinctStates(db.rules, db.numPlayers)
+	buf := make([]byte, 8*db.numPlayers)
+	err = writeDBFile(f, header, numStates, func(gsID int) []byte {
+		pWin := db.getID(gsID)
+		for i := 0; i < db.numPlayers; i++ {
+			Float64Encoding.encode(buf[8*i:], pWin[i])
+		}
+		return buf
+	})
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func (db *MemDB) NumPlayers() int {
+	return db.numPlayers
+}
+
+// The number of game states that have been stored.
+func (db *MemDB) Len() int {
+	n := 0
+	for i := range db.shards {
+		shard := &db.shards[i]
+		shard.mx.RLock()
+		n += len(shard.values)
+		shard.mx.RUnlock()
+	}
+	return n
+}
+
+func (db *MemDB) Put(gs GameState, pWin [maxNumPlayers]float64) {
+	db.putID(gs.ID(db.rules), pWin)
+}
+
+func (db *MemDB) putID(gsID int, pWin [maxNumPlayers]float64) {
+	shard := &db.shards[gsID%numMemDBShards]
+	shard.mx.Lock()
+	shard.values[gsID] = pWin
+	shard.mx.Unlock()
+}
+
+func (db *MemDB) Get(gs GameState) [maxNumPlayers]float64 {
+	return db.getID(gs.ID(db.rules))
+}
+
+func (db *MemDB) getID(gsID int) [maxNumPlayers]float64 {
+	shard := &db.shards[gsID%numMemDBShards]
+	shard.mx.RLock()
+	pWin, ok := shard.values[gsID]
+	shard.mx.RUnlock()
+	if !ok {
+		return db.initialValue()
+	}
+	return pWin
+}
+
+// The value of a game state that has not been stored.
+func (db *MemDB) initialValue() [maxNumPlayers]float64 {
+	var result [maxNumPlayers]float64
+	for i := 0; i < db.numPlayers; i++ {
+		result[i] = 1.0 / float64(db.numPlayers)
+	}
+	return result
+}
+
+// Values are stored under a per-shard lock.
+func (db *MemDB) concurrent() {}
+
+func (db *MemDB) Close() error {
+	return nil
+}
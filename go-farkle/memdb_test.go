@@ -0,0 +1,90 @@
+package farkle
+
+import (
+	"iter"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// Rules for a game small enough to solve in a test.
+var tinyRules = &Rules{
+	Scoring: &ScoringRules{
+		Name: "tiny",
+		TrickScores: [numTrickTypes]int{
+			Single1: 100,
+			Single5: 100,
+			Three1s: 300,
+		},
+	},
+	ScoreToWin:     300,
+	ScoreIncrement: 100,
+}
+
+const tinyNumPlayers = 2
+
+// Write the sorted game states of the tiny game to a file.
+func tinyGameStates(t testing.TB) string {
+	return gameStatesFile(t, tinyRules, tinyNumPlayers)
+}
+
+func iterTinyGameStates(t testing.TB, path string) iter.Seq2[uint16, GameState] {
+	return iterGameStatesFile(t, tinyRules, tinyNumPlayers, path)
+}
+
+// Solve the tiny game until it converges.
+func solveTiny(t *testing.T, db DB, statesPath string) {
+	solveGame(t, tinyRules, tinyNumPlayers, db, statesPath)
+}
+
+func TestMemDBMatchesFileDB(t *testing.T) {
+	statesPath := tinyGameStates(t)
+	memDB := NewMemDB(tinyRules, tinyNumPlayers)
+	solveTiny(t, memDB, statesPath)
+	fileDB, err := NewFileDB(filepath.Join(t.TempDir(), "tiny.db"), tinyRules, tinyNumPlayers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fileDB.Close()
+	solveTiny(t, fileDB, statesPath)
+
+	n := 0
+	for _, state := range iterTinyGameStates(t, statesPath) {
+		got, expected := memDB.Get(state), fileDB.Get(state)
+		for i := 0; i < tinyNumPlayers; i++ {
+			if math.Abs(got[i]-expected[i]) > 1e-8 {
+				t.Fatalf("state %s: MemDB has %v, FileDB has %v",
+					tinyRules.FormatState(state), got, expected)
+			}
+		}
+		n++
+	}
+	if n == 0 || memDB.Len() == 0 {
+		t.Errorf("solved %d states with %d stored", n, memDB.Len())
+	}
+}
+
+func TestMemDBSaveAndLoad(t *testing.T) {
+	statesPath := tinyGameStates(t)
+	db := NewMemDB(tinyRules, tinyNumPlayers)
+	solveTiny(t, db, statesPath)
+
+	path := filepath.Join(t.TempDir(), "tiny.db")
+	if err := db.SaveTo(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadMemDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.NumPlayers() != tinyNumPlayers || !loaded.rules.Equal(tinyRules) {
+		t.Errorf("loaded %d-player database with rules {%v}", loaded.NumPlayers(), loaded.rules)
+	}
+	numStates := calcNumDistinctStates(tinyRules, tinyNumPlayers)
+	for gsID := 0; gsID < numStates; gsID++ {
+		if got, expected := loaded.getID(gsID), db.getID(gsID); got != expected {
+			t.Fatalf("state %d: loaded %v, saved %v", gsID, got, expected)
+		}
+	}
+}
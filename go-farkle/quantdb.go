@@ -0,0 +1,319 @@
+package farkle
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+)
+
+// ValueEncoding is the representation of win probabilities in a database file.
+type ValueEncoding int
+
+const (
+	// numPlayers float64 values per game state, as stored by FileDB.
+	Float64Encoding ValueEncoding = iota
+	// numPlayers-1 float32 values per game state.
+	Float32Encoding
+	// numPlayers-1 fixed-point values per game state, in units of 1/MaxUint32.
+	Uint32Encoding
+	// numPlayers-1 fixed-point values per game state, in units of 1/MaxUint16.
+	Uint16Encoding
+	numValueEncodings
+)
+
+var valueEncodingNames = [numValueEncodings]string{
+	Float64Encoding: "float64",
+	Float32Encoding: "float32",
+	Uint32Encoding:  "uint32",
+	Uint16Encoding:  "uint16",
+}
+
+func (e ValueEncoding) String() string {
+	if e < 0 || e >= numValueEncodings {
+		return fmt.Sprintf("ValueEncoding(%d)", int(e))
+	}
+	return valueEncodingNames[e]
+}
+
+// Parse the name of a value encoding, e.g. as given on the command line.
+func ParseValueEncoding(name string) (ValueEncoding, error) {
+	for e, encName := range valueEncodingNames {
+		if name == encName {
+			return ValueEncoding(e), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown value encoding %q, valid options: %s",
+		name, strings.Join(valueEncodingNames[:], ", "))
+}
+
+// Number of bytes used to store each value.
+func (e ValueEncoding) valueSize() int {
+	switch e {
+	case Float64Encoding:
+		return 8
+	case Float32Encoding, Uint32Encoding:
+		return 4
+	case Uint16Encoding:
+		return 2
+	default:
+		panic(fmt.Errorf("unknown value encoding: %d", int(e)))
+	}
+}
+
+// Fixed-width representation of a win probability.
+func (e ValueEncoding) toBits(p float64) uint64 {
+	switch e {
+	case Float64Encoding:
+		return math.Float64bits(p)
+	case Float32Encoding:
+		return uint64(math.Float32bits(float32(p)))
+	case Uint32Encoding:
+		p = min(max(p, 0), 1)
+		return uint64(math.Round(p * math.MaxUint32))
+	case Uint16Encoding:
+		p = min(max(p, 0), 1)
+		return uint64(math.Round(p * math.MaxUint16))
+	default:
+		panic(fmt.Errorf("unknown value encoding: %d", int(e)))
+	}
+}
+
+func (e ValueEncoding) fromBits(x uint64) float64 {
+	switch e {
+	case Float64Encoding:
+		return math.Float64frombits(x)
+	case Float32Encoding:
+		return float64(math.Float32frombits(uint32(x)))
+	case Uint32Encoding:
+		return float64(x) / math.MaxUint32
+	case Uint16Encoding:
+		return float64(x) / math.MaxUint16
+	default:
+		panic(fmt.Errorf("unknown value encoding: %d", int(e)))
+	}
+}
+
+func (e ValueEncoding) encode(buf []byte, p float64) {
+	switch x := e.toBits(p); e.valueSize() {
+	case 8:
+		binary.LittleEndian.PutUint64(buf, x)
+	case 4:
+		binary.LittleEndian.PutUint32(buf, uint32(x))
+	case 2:
+		binary.LittleEndian.PutUint16(buf, uint16(x))
+	}
+}
+
+func (e ValueEncoding) decode(buf []byte) float64 {
+	switch e.valueSize() {
+	case 8:
+		return e.fromBits(binary.LittleEndian.Uint64(buf))
+	case 4:
+		return e.fromBits(uint64(binary.LittleEndian.Uint32(buf)))
+	default:
+		return e.fromBits(uint64(binary.LittleEndian.Uint16(buf)))
+	}
+}
+
+// Like encode, but the value is stored atomically. buf must be
+// aligned to the value size.
+func (e ValueEncoding) store(buf []byte, p float64) {
+	switch x := e.toBits(p); e.valueSize() {
+	case 8:
+		atomicStoreUint64(buf, x)
+	case 4:
+		atomicStoreUint32(buf, uint32(x))
+	case 2:
+		atomicStoreUint16(buf, uint16(x))
+	}
+}
+
+// Like decode, but the value is loaded atomically. buf must be
+// aligned to the value size.
+func (e ValueEncoding) load(buf []byte) float64 {
+	switch e.valueSize() {
+	case 8:
+		return e.fromBits(atomicLoadUint64(buf))
+	case 4:
+		return e.fromBits(uint64(atomicLoadUint32(buf)))
+	default:
+		return e.fromBits(uint64(atomicLoadUint16(buf)))
+	}
+}
+
+// PersistentDB is a DB stored in a file with a DBHeader.
+type PersistentDB interface {
+	DB
+	// The header describing this database.
+	Header() DBHeader
+	// Record the completion of a value iteration cycle with the given residual.
+	RecordIteration(residual float64) error
+	// Check that the stored values match the checksum in the header.
+	VerifyChecksum() error
+	// Flush all changes to disk.
+	Sync() error
+}
+
+// Open the database at the given path with the given encoding,
+// creating it if it does not exist.
+func OpenDB(path string, rules *Rules, numPlayers int, encoding ValueEncoding) (PersistentDB, error) {
+	if encoding == Float64Encoding {
+		return NewFileDB(path, rules, numPlayers)
+	}
+	return NewQuantizedDB(path, rules, numPlayers, encoding)
+}
+
+// Open an existing database with the given encoding for reading only.
+// It is an error if the file does not exist, and the file may be shared
+// by any number of processes.
+func OpenDBReadOnly(path string, rules *Rules, numPlayers int, encoding ValueEncoding) (PersistentDB, error) {
+	if encoding == Float64Encoding {
+		return OpenFileDBReadOnly(path, rules, numPlayers)
+	}
+	return OpenQuantizedDBReadOnly(path, rules, numPlayers, encoding)
+}
+
+// DB that stores results in a memory-mapped flat file with reduced precision.
+// Since the win probabilities of all players sum to 1, only the first
+// numPlayers-1 are stored for each game state.
+type QuantizedDB struct {
+	*mappedFile
+	numPlayers int
+	encoding   ValueEncoding
+	valueSize  int
+	nPuts      atomic.Int64
+}
+
+func NewQuantizedDB(path string, rules *Rules, numPlayers int, encoding ValueEncoding) (*QuantizedDB, error) {
+	if encoding == Float64Encoding {
+		return nil, fmt.Errorf("use FileDB for %v encoding", encoding)
+	}
+	if !rules.TieBreak.conservesWins() {
+		return nil, fmt.Errorf("%v encoding requires win probabilities that sum to 1, "+
+			"which the %v tie-break policy does not guarantee", encoding, rules.TieBreak)
+	}
+
+	header := newDBHeader(rules, numPlayers, encoding)
+	valueSize := encoding.valueSize()
+	defaultValue := make([]byte, valueSize*(numPlayers-1))
+	for i := 0; i < numPlayers-1; i++ {
+		encoding.encode(defaultValue[valueSize*i:], 1.0/float64(numPlayers))
+	}
+
+	mf, err := openMappedFile(path, header, defaultValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QuantizedDB{
+		mappedFile: mf,
+		numPlayers: numPlayers,
+		encoding:   encoding,
+		valueSize:  valueSize,
+	}, nil
+}
+
+// Open an existing QuantizedDB for reading only.
+func OpenQuantizedDBReadOnly(path string, rules *Rules, numPlayers int, encoding ValueEncoding) (*QuantizedDB, error) {
+	if encoding == Float64Encoding {
+		return nil, fmt.Errorf("use FileDB for %v encoding", encoding)
+	}
+	if !rules.TieBreak.conservesWins() {
+		return nil, fmt.Errorf("%v encoding requires win probabilities that sum to 1, "+
+			"which the %v tie-break policy does not guarantee", encoding, rules.TieBreak)
+	}
+
+	header := newDBHeader(rules, numPlayers, encoding)
+	valueSize := encoding.valueSize()
+	mf, err := mapFile(path, header, valueSize*(numPlayers-1), true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QuantizedDB{
+		mappedFile: mf,
+		numPlayers: numPlayers,
+		encoding:   encoding,
+		valueSize:  valueSize,
+	}, nil
+}
+
+func (db *QuantizedDB) NumPlayers() int {
+	return db.numPlayers
+}
+
+func (db *QuantizedDB) Put(gs GameState, pWin [maxNumPlayers]float64) {
+	db.checkWritable()
+	db.putID(gs.ID(db.header.Rules), pWin)
+
+	if n := db.nPuts.Add(1); n%100000 == 0 {
+		glog.Infof(
+			"%d puts into database. Last put: %s -> %v",
+			n, db.header.Rules.FormatState(gs), pWin[:gs.NumPlayers])
+	}
+}
+
+func (db *QuantizedDB) putID(gsID int, pWin [maxNumPlayers]float64) {
+	entrySize := db.valueSize * (db.numPlayers - 1)
+	buf := db.values[entrySize*gsID : entrySize*(gsID+1)]
+	for i, p := range pWin[:db.numPlayers-1] {
+		db.encoding.store(buf[db.valueSize*i:], p)
+	}
+}
+
+func (db *QuantizedDB) Get(gs GameState) [maxNumPlayers]float64 {
+	return db.getID(gs.ID(db.header.Rules))
+}
+
+func (db *QuantizedDB) getID(gsID int) [maxNumPlayers]float64 {
+	entrySize := db.valueSize * (db.numPlayers - 1)
+	buf := db.values[entrySize*gsID : entrySize*(gsID+1)]
+	var result [maxNumPlayers]float64
+	remaining := 1.0
+	for i := 0; i < db.numPlayers-1; i++ {
+		result[i] = db.encoding.load(buf[db.valueSize*i:])
+		remaining -= result[i]
+	}
+	result[db.numPlayers-1] = max(remaining, 0)
+	return result
+}
+
+func (db *QuantizedDB) Close() error {
+	return db.close(db.nPuts.Load() > 0)
+}
+
+// Copy all values from a float64 database into a quantized database
+// for the same game, returning the maximum absolute error introduced
+// in any win probability.
+func ConvertDB(src *FileDB, dst *QuantizedDB) (float64, error) {
+	if dst.readOnly {
+		return 0, fmt.Errorf("cannot convert into read-only database %s", dst.f.Name())
+	}
+	if err := dst.header.checkCompatible(newDBHeader(src.header.Rules, src.numPlayers, dst.encoding)); err != nil {
+		return 0, err
+	}
+
+	maxErr := 0.0
+	numStates := calcNumDistinctStates(src.header.Rules, src.numPlayers)
+	for gsID := 0; gsID < numStates; gsID++ {
+		pWin := src.getID(gsID)
+		dst.putID(gsID, pWin)
+		converted := dst.getID(gsID)
+		for i, p := range pWin[:src.numPlayers] {
+			maxErr = max(maxErr, math.Abs(converted[i]-p))
+		}
+
+		if gsID%100000000 == 0 {
+			glog.Infof("...%d", gsID)
+		}
+	}
+
+	dst.nPuts.Add(int64(numStates))
+	dst.header.NumIterations = src.header.NumIterations
+	dst.header.LastResidual = src.header.LastResidual
+	return maxErr, dst.writeHeader()
+}
@@ -0,0 +1,113 @@
+package farkle
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestValueEncodingErrorBound(t *testing.T) {
+	testCases := []struct {
+		encoding ValueEncoding
+		// Largest absolute error of a value in [0, 1].
+		maxErr float64
+	}{
+		{Float64Encoding, 0},
+		{Float32Encoding, 0x1p-25},
+		{Uint32Encoding, 0.5 / math.MaxUint32},
+		{Uint16Encoding, 0.5 / math.MaxUint16},
+	}
+	values := []float64{0, 1, 0.5, 1.0 / 3, 2.0 / 3, 1e-9, 0.123456789, 1 - 1e-9}
+
+	for _, tc := range testCases {
+		t.Run(tc.encoding.String(), func(t *testing.T) {
+			buf := make([]byte, tc.encoding.valueSize())
+			for _, p := range values {
+				tc.encoding.encode(buf, p)
+				if got := tc.encoding.decode(buf); math.Abs(got-p) > tc.maxErr {
+					t.Errorf("%v decoded as %v, error %g > %g", p, got, math.Abs(got-p), tc.maxErr)
+				}
+			}
+		})
+	}
+}
+
+func TestFixedPointEncodingClamps(t *testing.T) {
+	for _, encoding := range []ValueEncoding{Uint32Encoding, Uint16Encoding} {
+		buf := make([]byte, encoding.valueSize())
+		for p, want := range map[float64]float64{-0.25: 0, 1.25: 1} {
+			encoding.encode(buf, p)
+			if got := encoding.decode(buf); got != want {
+				t.Errorf("%v: %v decoded as %v, expected %v", encoding, p, got, want)
+			}
+		}
+	}
+}
+
+func TestConvertDB(t *testing.T) {
+	rules := &Rules{
+		Scoring: &ScoringRules{
+			Name: "singles",
+			TrickScores: [numTrickTypes]int{
+				Single1: 100,
+				Single5: 100,
+			},
+		},
+		ScoreToWin:     300,
+		ScoreIncrement: 100,
+	}
+	const numPlayers = 3
+	dir := t.TempDir()
+
+	src, err := NewFileDB(filepath.Join(dir, "3player.db"), rules, numPlayers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	numStates := calcNumDistinctStates(rules, numPlayers)
+	for gsID := 0; gsID < numStates; gsID++ {
+		p := float64(gsID) / float64(numStates)
+		src.putID(gsID, [maxNumPlayers]float64{p / 2, 1 - p, p / 2})
+	}
+	if err := src.RecordIteration(1e-3); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := NewQuantizedDB(filepath.Join(dir, "3player.uint16.db"), rules, numPlayers, Uint16Encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	maxErr, err := ConvertDB(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last player's win probability is the remainder of the others'.
+	bound := (numPlayers - 1) * 0.5 / math.MaxUint16
+	if maxErr <= 0 || maxErr > bound {
+		t.Errorf("maximum error %g, expected in (0, %g]", maxErr, bound)
+	}
+	for gsID := 0; gsID < numStates; gsID++ {
+		expected, got := src.getID(gsID), dst.getID(gsID)
+		for i := 0; i < numPlayers; i++ {
+			if math.Abs(got[i]-expected[i]) > maxErr {
+				t.Fatalf("state %d: got %v, expected %v", gsID, got, expected)
+			}
+		}
+	}
+	if got := dst.Header().NumIterations; got != 1 {
+		t.Errorf("converted database has %d iterations, expected 1", got)
+	}
+
+	other := *rules
+	other.ScoreToWin = 200
+	mismatched, err := NewQuantizedDB(filepath.Join(dir, "other.db"), &other, numPlayers, Uint16Encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mismatched.Close()
+	if _, err := ConvertDB(src, mismatched); err == nil {
+		t.Errorf("converted into a database for different rules")
+	}
+}
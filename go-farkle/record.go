@@ -0,0 +1,237 @@
+package farkle
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+)
+
+// A game record is written as JSON Lines: a "game" line with the
+// GameRecordHeader, followed by a "roll" line for each RecordedRoll in
+// order of play. A file may hold any number of games one after another.
+
+// GameRecordHeader describes a recorded game.
+type GameRecordHeader struct {
+	Rules      *Rules `json:"rules"`
+	NumPlayers int    `json:"num_players"`
+	// Dice source the game was played with, e.g. "seed:12345",
+	// as accepted by ParseDiceSource.
+	Dice string `json:"dice"`
+	// Name of the player in each seat in order of play,
+	// e.g. their strategy such as "greedy".
+	Players []string `json:"players,omitempty"`
+}
+
+// RecordedRoll is a single roll and the action taken after it.
+type RecordedRoll struct {
+	// Seat of the player rolling.
+	Seat int `json:"seat"`
+	// Banked score of each seat before rolling, in points.
+	Scores []int `json:"scores"`
+	// Points accumulated by the player this turn before rolling.
+	ScoreThisRound int  `json:"score_this_round"`
+	Roll           Roll `json:"roll"`
+	// Action taken, or the zero Action if the roll was a farkle.
+	Action Action `json:"action"`
+	// Evaluation of the action, if it was played with a solution database.
+	Eval *ActionEval `json:"eval,omitempty"`
+}
+
+// ActionEval compares the action taken with the optimal action.
+type ActionEval struct {
+	BestAction Action `json:"best_action"`
+	// Win probability of the player rolling with the action taken,
+	// and with the optimal action.
+	WinProb     float64 `json:"win_prob"`
+	BestWinProb float64 `json:"best_win_prob"`
+}
+
+// GameRecord is a complete recorded game.
+type GameRecord struct {
+	Header GameRecordHeader
+	Rolls  []RecordedRoll
+}
+
+// One line of a game record, either a header or a roll.
+type recordLine struct {
+	Type string `json:"type"`
+	*GameRecordHeader
+	*RecordedRoll
+}
+
+const (
+	recordTypeGame = "game"
+	recordTypeRoll = "roll"
+)
+
+// Record a roll at the given table, with the seat of the current player.
+func NewRecordedRoll(rules *Rules, table Table, seat int, roll Roll, action Action) RecordedRoll {
+	n := int(table.NumPlayers)
+	scores := make([]int, n)
+	for i, score := range table.PlayerScores[:n] {
+		scores[(seat+i)%n] = rules.Points(score)
+	}
+
+	return RecordedRoll{
+		Seat:           seat,
+		Scores:         scores,
+		ScoreThisRound: rules.Points(table.ScoreThisRound),
+		Roll:           roll,
+		Action:         action,
+	}
+}
+
+// Compare the action taken with the best of the ranked actions.
+func (ranked RankedActions) Evaluate(action Action) *ActionEval {
+	selected, _ := ranked.Find(action)
+	return &ActionEval{
+		BestAction:  ranked[0].Action,
+		WinProb:     selected.WinProb[0],
+		BestWinProb: ranked[0].WinProb[0],
+	}
+}
+
+// GameRecordWriter writes games as JSON Lines.
+type GameRecordWriter struct {
+	enc *json.Encoder
+}
+
+func NewGameRecordWriter(w io.Writer) *GameRecordWriter {
+	return &GameRecordWriter{enc: json.NewEncoder(w)}
+}
+
+// Start a new game.
+func (w *GameRecordWriter) WriteHeader(header GameRecordHeader) error {
+	return w.enc.Encode(recordLine{Type: recordTypeGame, GameRecordHeader: &header})
+}
+
+// Add a roll to the current game.
+func (w *GameRecordWriter) WriteRoll(roll RecordedRoll) error {
+	return w.enc.Encode(recordLine{Type: recordTypeRoll, RecordedRoll: &roll})
+}
+
+// Write a complete game.
+func (w *GameRecordWriter) WriteGame(game GameRecord) error {
+	if err := w.WriteHeader(game.Header); err != nil {
+		return err
+	}
+	for _, roll := range game.Rolls {
+		if err := w.WriteRoll(roll); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read the games in a record, in order. Iteration stops after
+// the first error.
+func ReadGameRecords(r io.Reader) iter.Seq2[GameRecord, error] {
+	return func(yield func(GameRecord, error) bool) {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, 1<<20)
+		var game *GameRecord
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			var line recordLine
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				yield(GameRecord{}, fmt.Errorf("line %d: %w", lineNo, err))
+				return
+			}
+
+			switch line.Type {
+			case recordTypeGame:
+				if game != nil && !yield(*game, nil) {
+					return
+				}
+				var header GameRecordHeader
+				if line.GameRecordHeader != nil {
+					header = *line.GameRecordHeader
+				}
+				if err := checkRecordHeader(&header); err != nil {
+					yield(GameRecord{}, fmt.Errorf("line %d: %w", lineNo, err))
+					return
+				}
+				game = &GameRecord{Header: header}
+			case recordTypeRoll:
+				if game == nil {
+					yield(GameRecord{}, fmt.Errorf("line %d: roll before the start of a game", lineNo))
+					return
+				}
+				if line.RecordedRoll == nil {
+					yield(GameRecord{}, fmt.Errorf("line %d: empty roll", lineNo))
+					return
+				}
+				game.Rolls = append(game.Rolls, *line.RecordedRoll)
+			default:
+				yield(GameRecord{}, fmt.Errorf("line %d: unknown record type %q", lineNo, line.Type))
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			yield(GameRecord{}, err)
+			return
+		}
+		if game != nil {
+			yield(*game, nil)
+		}
+	}
+}
+
+// The table before each roll, checking that every roll and action
+// is consistent with the rules and the rolls before it.
+func (g GameRecord) Tables() ([]Table, error) {
+	rules := g.Header.Rules
+	n := g.Header.NumPlayers
+	tables := make([]Table, 0, len(g.Rolls))
+	table := NewTable(n)
+	seat := 0
+	for i, rr := range g.Rolls {
+		if table.IsGameOver(rules) {
+			return nil, fmt.Errorf("roll %d: game is already over", i)
+		}
+		expected := NewRecordedRoll(rules, table, seat, rr.Roll, rr.Action)
+		if rr.Seat != seat {
+			return nil, fmt.Errorf("roll %d: expected seat %d to roll, got %d", i, seat, rr.Seat)
+		}
+		if !slices.Equal(rr.Scores, expected.Scores) || rr.ScoreThisRound != expected.ScoreThisRound {
+			return nil, fmt.Errorf("roll %d: expected scores %v and %d this round, got %v and %d",
+				i, expected.Scores, expected.ScoreThisRound, rr.Scores, rr.ScoreThisRound)
+		}
+		if rr.Roll.NumDice() != table.NumDiceToRoll {
+			return nil, fmt.Errorf("roll %d: rolled %d dice, expected %d",
+				i, rr.Roll.NumDice(), table.NumDiceToRoll)
+		}
+		if IsFarkle(rules.Scoring, rr.Roll) {
+			if rr.Action != (Action{}) {
+				return nil, fmt.Errorf("roll %d: action %v after farkle", i, rr.Action)
+			}
+		} else if err := legalActionError(rules, table, rr.Roll, rr.Action); err != nil {
+			return nil, fmt.Errorf("roll %d: %w", i, err)
+		}
+
+		tables = append(tables, table)
+		table = ApplyTableAction(rules, table, rr.Action)
+		if !rr.Action.ContinueRolling {
+			seat = (seat + 1) % n
+		}
+	}
+
+	return tables, nil
+}
+
+func checkRecordHeader(header *GameRecordHeader) error {
+	if header.Rules == nil {
+		return fmt.Errorf("game has no rules")
+	}
+	if err := header.Rules.Validate(); err != nil {
+		return err
+	}
+	header.Rules.Scoring = header.Rules.Scoring.canonical()
+	if header.NumPlayers < 1 || header.NumPlayers > MaxNumPlayers {
+		return fmt.Errorf("invalid number of players: %d", header.NumPlayers)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package farkle
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGameRecordRoundTrip(t *testing.T) {
+	rules := DefaultRules
+	greedy, err := NewHeuristicStrategy(rules, "greedy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	strategies := []Strategy{greedy, &ThresholdStrategy{Rules: rules, Threshold: 300}}
+
+	var games []GameRecord
+	var buf bytes.Buffer
+	w := NewGameRecordWriter(&buf)
+	for seed := int64(1); seed <= 2; seed++ {
+		_, rolls, err := PlayRecordedGame(rules, strategies, NewSeededDice(seed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		game := GameRecord{
+			Header: GameRecordHeader{
+				Rules:      rules,
+				NumPlayers: len(strategies),
+				Dice:       fmt.Sprintf("seed:%d", seed),
+				Players:    []string{"greedy", "threshold:300"},
+			},
+			Rolls: rolls,
+		}
+		if err := w.WriteGame(game); err != nil {
+			t.Fatal(err)
+		}
+		games = append(games, game)
+	}
+
+	var got []GameRecord
+	for game, err := range ReadGameRecords(&buf) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, game)
+	}
+	if len(got) != len(games) {
+		t.Fatalf("read %d games, expected %d", len(got), len(games))
+	}
+	for i, game := range got {
+		if !game.Header.Rules.Equal(rules) {
+			t.Errorf("game %d: got rules {%v}, expected {%v}", i, game.Header.Rules, rules)
+		}
+		game.Header.Rules = rules
+		if !reflect.DeepEqual(game, games[i]) {
+			t.Errorf("game %d: got %+v, expected %+v", i, game, games[i])
+		}
+
+		tables, err := game.Tables()
+		if err != nil {
+			t.Fatalf("game %d: %v", i, err)
+		}
+		if len(tables) != len(game.Rolls) || tables[0] != NewTable(2) {
+			t.Errorf("game %d: got %d tables starting at %v", i, len(tables), tables[0])
+		}
+	}
+}
+
+func TestGameRecordTablesRejectsIllegal(t *testing.T) {
+	rules := shortGameRules
+	record := func() GameRecord {
+		// Seat 0 banks a straight, and seat 1 farkles to end the game.
+		dice := NewScriptedDice(1, 2, 3, 4, 5, 6, 2, 2, 3, 3, 4, 6)
+		_, rolls, err := PlayRecordedGame(rules, thresholdStrategies(rules, 2), dice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return GameRecord{
+			Header: GameRecordHeader{Rules: rules, NumPlayers: 2, Dice: "file:script"},
+			Rolls:  rolls,
+		}
+	}
+	if _, err := record().Tables(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		modify  func(g *GameRecord)
+		wantErr string
+	}{
+		{"wrong number of dice", func(g *GameRecord) {
+			g.Rolls[0].Roll = NewRoll(1, 2, 3, 4, 5)
+		}, "rolled 5 dice"},
+		{"hold not rolled", func(g *GameRecord) {
+			g.Rolls[0].Action.HeldDiceID = GetRollID(NewRoll(1, 1))
+		}, "not a valid hold"},
+		{"hold does not score", func(g *GameRecord) {
+			g.Rolls[0].Action.HeldDiceID = GetRollID(NewRoll(2))
+		}, "not a valid hold"},
+		{"stop before opening", func(g *GameRecord) {
+			g.Rolls[0].Action = Action{HeldDiceID: GetRollID(NewRoll(1))}
+		}, "must continue rolling"},
+		{"action after farkle", func(g *GameRecord) {
+			g.Rolls[1].Action = Action{HeldDiceID: GetRollID(NewRoll(2, 2))}
+		}, "after farkle"},
+		{"wrong seat", func(g *GameRecord) {
+			g.Rolls[1].Seat = 0
+		}, "seat"},
+		{"wrong scores", func(g *GameRecord) {
+			g.Rolls[1].Scores = []int{0, 0}
+		}, "scores"},
+		{"roll after game over", func(g *GameRecord) {
+			g.Rolls = append(g.Rolls, g.Rolls[0])
+		}, "already over"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			game := record()
+			tc.modify(&game)
+			_, err := game.Tables()
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %v, expected one about %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadGameRecordsErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"not JSON", "{", "line 1"},
+		{"roll first", `{"type":"roll","seat":0}`, "before the start of a game"},
+		{"unknown type", `{"type":"move"}`, "unknown record type"},
+		{"no rules", `{"type":"game","num_players":2}`, "no rules"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			for _, err = range ReadGameRecords(strings.NewReader(tc.input)) {
+				if err != nil {
+					break
+				}
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %v, expected one about %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package farkle
+
+import "fmt"
+
+// Rules defines the variant of the game being solved or played.
+type Rules struct {
+	// Scoring rules used to value each trick.
+	Scoring *ScoringRules
+	// Once a player banks at least this many points, every other
+	// player gets one last turn and the game ends.
+	ScoreToWin int
+	// Minimum number of points a player must bank in a single turn
+	// to get on the board. Zero means there is no entry threshold.
+	MinOpeningScore int
+	// Points deducted when a player farkles NumFarklesForPenalty turns
+	// in a row. Zero means there is no penalty.
+	FarklePenalty int
+	// Scores are tracked as multiples of ScoreIncrement points, stored in
+	// ScoreWidth bytes (1 or 2). They are capped at the score to win plus
+	// the most points a single roll can score, or at the largest unsigned
+	// integer of that width if it is lower. Zero means the default of
+	// 50 points in 1 byte, capped at 12,750.
+	ScoreIncrement int
+	ScoreWidth     int
+	// How a game that ends with several players tied for the highest
+	// score is valued. Zero means the win is split among them.
+	TieBreak TieBreak
+}
+
+const (
+	DefaultScoreIncrement = 50
+	DefaultScoreWidth     = 1
+	maxScoreWidth         = 2
+)
+
+// Number of consecutive farkles that incur the FarklePenalty.
+const NumFarklesForPenalty = 3
+
+// The rules used in the original version of this solver:
+// first to 10,000, with 500 points needed to get on the board.
+var DefaultRules = &Rules{
+	Scoring:         StandardScoring,
+	ScoreToWin:      10000,
+	MinOpeningScore: 500,
+}
+
+// Check that the rules can be represented by the solver.
+func (rules *Rules) Validate() error {
+	if rules.Scoring == nil {
+		return fmt.Errorf("no scoring rules")
+	}
+
+	if rules.ScoreIncrement < 0 {
+		return fmt.Errorf("score increment must be positive, got %d", rules.ScoreIncrement)
+	}
+	if rules.TieBreak < 0 || rules.TieBreak >= numTieBreaks {
+		return fmt.Errorf("unknown tie-break policy: %v", rules.TieBreak)
+	}
+	if rules.ScoreWidth < 0 || rules.ScoreWidth > maxScoreWidth {
+		return fmt.Errorf("score width must be 1-%d bytes, got %d", maxScoreWidth, rules.ScoreWidth)
+	}
+
+	incr := rules.scoreIncrement()
+	maxScore := rules.Points(rules.maxStoredScore())
+	for t, score := range rules.Scoring.TrickScores {
+		if rules.Scoring.allows(TrickType(t)) && (score%incr != 0 || score > maxScore) {
+			return fmt.Errorf("score for %s in %s rules must be a multiple of %d <= %d, got %d",
+				TrickType(t), rules.Scoring.Name, incr, maxScore, score)
+		}
+	}
+
+	if rules.ScoreToWin <= 0 || rules.ScoreToWin%incr != 0 || rules.ScoreToWin > maxScore {
+		return fmt.Errorf("score to win must be a positive multiple of %d <= %d, got %d",
+			incr, maxScore, rules.ScoreToWin)
+	}
+
+	if rules.MinOpeningScore < 0 || rules.MinOpeningScore%incr != 0 || rules.MinOpeningScore > rules.ScoreToWin {
+		return fmt.Errorf("minimum opening score must be a non-negative multiple of %d <= %d, got %d",
+			incr, rules.ScoreToWin, rules.MinOpeningScore)
+	}
+
+	if rules.FarklePenalty < 0 || rules.FarklePenalty%incr != 0 || rules.FarklePenalty > maxScore {
+		return fmt.Errorf("farkle penalty must be a non-negative multiple of %d <= %d, got %d",
+			incr, maxScore, rules.FarklePenalty)
+	}
+
+	return nil
+}
+
+func (rules *Rules) String() string {
+	return fmt.Sprintf("Scoring=%s, ScoreToWin=%d, MinOpeningScore=%d, FarklePenalty=%d, "+
+		"ScoreIncrement=%d, ScoreWidth=%d, TieBreak=%v",
+		rules.Scoring, rules.ScoreToWin, rules.MinOpeningScore, rules.FarklePenalty,
+		rules.scoreIncrement(), rules.scoreWidth(), rules.TieBreak)
+}
+
+// Whether two sets of rules define the same game.
+func (rules *Rules) Equal(other *Rules) bool {
+	return rules.Scoring.Equal(other.Scoring) &&
+		rules.ScoreToWin == other.ScoreToWin &&
+		rules.MinOpeningScore == other.MinOpeningScore &&
+		rules.FarklePenalty == other.FarklePenalty &&
+		rules.scoreIncrement() == other.scoreIncrement() &&
+		rules.scoreWidth() == other.scoreWidth() &&
+		rules.TieBreak == other.TieBreak
+}
+
+func (rules *Rules) scoreIncrement() int {
+	if rules.ScoreIncrement == 0 {
+		return DefaultScoreIncrement
+	}
+	return rules.ScoreIncrement
+}
+
+func (rules *Rules) scoreWidth() int {
+	if rules.ScoreWidth == 0 {
+		return DefaultScoreWidth
+	}
+	return rules.ScoreWidth
+}
+
+// Highest score that can be stored in ScoreWidth bytes,
+// in units of the score increment.
+func (rules *Rules) maxStoredScore() uint16 {
+	return uint16(1<<(8*rules.scoreWidth()) - 1)
+}
+
+// Highest score that is tracked, in units of the score increment.
+// Scores beyond the score to win plus the best single roll rarely change
+// the outcome of a game, so they saturate at this value.
+func (rules *Rules) maxScore() uint16 {
+	maxRoll := rules.Scoring.getTables().maxPoints / rules.scoreIncrement()
+	return uint16(min(int(rules.scoreToWin())+maxRoll, int(rules.maxStoredScore())))
+}
+
+// Number of distinct scores, in units of the score increment.
+func (rules *Rules) numScores() int {
+	return int(rules.maxScore()) + 1
+}
+
+// Points in a score in units of the score increment.
+func (rules *Rules) Points(score uint16) int {
+	return rules.scoreIncrement() * int(score)
+}
+
+// Convert a number of points to units of the score increment.
+func (rules *Rules) ScoreUnits(points int) (uint16, error) {
+	incr := rules.scoreIncrement()
+	maxScore := rules.Points(rules.maxScore())
+	if points < 0 || points%incr != 0 || points > maxScore {
+		return 0, fmt.Errorf("score must be a non-negative multiple of %d <= %d, got %d",
+			incr, maxScore, points)
+	}
+	return uint16(points / incr), nil
+}
+
+// Format a game state with scores in points.
+func (rules *Rules) FormatState(state GameState) string {
+	return state.format(rules.Points)
+}
+
+// Format a table with scores in points.
+func (rules *Rules) FormatTable(t Table) string {
+	return t.format(rules.Points)
+}
+
+// Score of the given held dice, in units of the score increment.
+func (rules *Rules) heldScore(heldDiceID uint16) uint16 {
+	points := rules.Scoring.getTables().points[heldDiceID]
+	return uint16(min(points/rules.scoreIncrement(), int(rules.maxScore())))
+}
+
+// Score to win, in units of the score increment.
+func (rules *Rules) scoreToWin() uint16 {
+	return uint16(rules.ScoreToWin / rules.scoreIncrement())
+}
+
+// Farkle penalty, in units of the score increment.
+func (rules *Rules) farklePenalty() uint16 {
+	return uint16(rules.FarklePenalty / rules.scoreIncrement())
+}
+
+// Minimum opening score, in units of the score increment.
+func (rules *Rules) minOpeningScore() uint16 {
+	return uint16(rules.MinOpeningScore / rules.scoreIncrement())
+}
+
+// Whether the current player may stop and bank their score after holding
+// the given dice. A player who is not yet on the board must keep rolling
+// until they have at least MinOpeningScore points this round.
+func (rules *Rules) CanStop(state GameState, heldDiceID uint16) bool {
+	return rules.canStop(state.CurrentPlayerScore(), state.ScoreThisRound, heldDiceID)
+}
+
+func (rules *Rules) canStop(score, scoreThisRound, heldDiceID uint16) bool {
+	if score > 0 {
+		return true
+	}
+
+	trickScore := rules.heldScore(heldDiceID)
+	if trickScore == 0 { // Farkle
+		return rules.minOpeningScore() == 0
+	}
+	return addScores(rules, scoreThisRound, trickScore) >= rules.minOpeningScore()
+}
@@ -1,8 +1,12 @@
 package farkle
 
-const numScoreBits = 8
-const incr = 50
-const scoreToWin = 10000 / incr
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
 
 type TrickType int
 
@@ -22,24 +26,171 @@ const (
 	ThreePairs
 	FourOfAKindPlusPair
 	TwoTriplets
+	numTrickTypes
 )
 
-var trickScores = map[TrickType]uint8{
-	Single1:             100 / incr,
-	Single5:             50 / incr,
-	Three1s:             300 / incr,
-	Three2s:             200 / incr,
-	Three3s:             300 / incr,
-	Three4s:             400 / incr,
-	Three5s:             500 / incr,
-	Three6s:             600 / incr,
-	FourOfAKind:         1000 / incr,
-	FiveOfAKind:         2000 / incr,
-	SixOfAKind:          3000 / incr,
-	Straight:            1500 / incr,
-	ThreePairs:          1500 / incr,
-	FourOfAKindPlusPair: 1500 / incr,
-	TwoTriplets:         2500 / incr,
+var trickTypeNames = [numTrickTypes]string{
+	Single1:             "Single1",
+	Single5:             "Single5",
+	Three1s:             "Three1s",
+	Three2s:             "Three2s",
+	Three3s:             "Three3s",
+	Three4s:             "Three4s",
+	Three5s:             "Three5s",
+	Three6s:             "Three6s",
+	FourOfAKind:         "FourOfAKind",
+	FiveOfAKind:         "FiveOfAKind",
+	SixOfAKind:          "SixOfAKind",
+	Straight:            "Straight",
+	ThreePairs:          "ThreePairs",
+	FourOfAKindPlusPair: "FourOfAKindPlusPair",
+	TwoTriplets:         "TwoTriplets",
+}
+
+func (t TrickType) String() string {
+	if t < 0 || t >= numTrickTypes {
+		return fmt.Sprintf("TrickType(%d)", int(t))
+	}
+	return trickTypeNames[t]
+}
+
+// ScoringRules is a set of (house) rules defining the value of each trick.
+// ScoringRules must not be copied after first use.
+type ScoringRules struct {
+	// Name of the rule set, e.g. as selected on the command line.
+	Name string
+	// Points awarded for each trick. Tricks worth zero points are not allowed.
+	// All scores must be multiples of the score increment of the Rules.
+	TrickScores [numTrickTypes]int
+	// If set, four, five and six of a kind are worth the corresponding
+	// three of a kind doubled for each additional die, and the
+	// FourOfAKind, FiveOfAKind and SixOfAKind scores are ignored.
+	DoubleNOfAKind bool
+
+	once   sync.Once
+	tables *scoringTables
+}
+
+// The rules used in the original version of this solver.
+var StandardScoring = &ScoringRules{
+	Name: "standard",
+	TrickScores: [numTrickTypes]int{
+		Single1:             100,
+		Single5:             50,
+		Three1s:             300,
+		Three2s:             200,
+		Three3s:             300,
+		Three4s:             400,
+		Three5s:             500,
+		Three6s:             600,
+		FourOfAKind:         1000,
+		FiveOfAKind:         2000,
+		SixOfAKind:          3000,
+		Straight:            1500,
+		ThreePairs:          1500,
+		FourOfAKindPlusPair: 1500,
+		TwoTriplets:         2500,
+	},
+}
+
+// Standard rules, except three 1s are worth 1000.
+var ClassicScoring = &ScoringRules{
+	Name: "classic",
+	TrickScores: [numTrickTypes]int{
+		Single1:             100,
+		Single5:             50,
+		Three1s:             1000,
+		Three2s:             200,
+		Three3s:             300,
+		Three4s:             400,
+		Three5s:             500,
+		Three6s:             600,
+		FourOfAKind:         1000,
+		FiveOfAKind:         2000,
+		SixOfAKind:          3000,
+		Straight:            1500,
+		ThreePairs:          1500,
+		FourOfAKindPlusPair: 1500,
+		TwoTriplets:         2500,
+	},
+}
+
+// N of a kind doubles the three of a kind score for each additional die,
+// a straight is worth 2500 and there is no four of a kind plus a pair.
+var DoublingScoring = &ScoringRules{
+	Name: "doubling",
+	TrickScores: [numTrickTypes]int{
+		Single1:     100,
+		Single5:     50,
+		Three1s:     300,
+		Three2s:     200,
+		Three3s:     300,
+		Three4s:     400,
+		Three5s:     500,
+		Three6s:     600,
+		Straight:    2500,
+		ThreePairs:  1500,
+		TwoTriplets: 2500,
+	},
+	DoubleNOfAKind: true,
+}
+
+var scoringPresets = map[string]*ScoringRules{
+	StandardScoring.Name: StandardScoring,
+	ClassicScoring.Name:  ClassicScoring,
+	DoublingScoring.Name: DoublingScoring,
+}
+
+// Look up one of the named preset scoring rules.
+func ScoringRulesByName(name string) (*ScoringRules, error) {
+	rules, ok := scoringPresets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown scoring rules %q, valid options: %s",
+			name, strings.Join(ScoringRulesNames(), ", "))
+	}
+	return rules, nil
+}
+
+// Names of all preset scoring rules, in sorted order.
+func ScoringRulesNames() []string {
+	names := make([]string, 0, len(scoringPresets))
+	for name := range scoringPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (rules *ScoringRules) String() string {
+	return rules.Name
+}
+
+// Whether two sets of scoring rules are the same.
+func (rules *ScoringRules) Equal(other *ScoringRules) bool {
+	return rules.Name == other.Name &&
+		rules.TrickScores == other.TrickScores &&
+		rules.DoubleNOfAKind == other.DoubleNOfAKind
+}
+
+// The preset with the same rules if there is one, so that its lookup
+// tables are shared, or else these rules.
+func (rules *ScoringRules) canonical() *ScoringRules {
+	if preset, ok := scoringPresets[rules.Name]; ok && preset.Equal(rules) {
+		return preset
+	}
+	return rules
+}
+
+// Whether the given trick may be scored under these rules.
+func (rules *ScoringRules) allows(t TrickType) bool {
+	if rules.DoubleNOfAKind && isNOfAKind(t) {
+		return true
+	}
+	return rules.TrickScores[t] > 0
+}
+
+func isNOfAKind(t TrickType) bool {
+	return t == FourOfAKind || t == FiveOfAKind || t == SixOfAKind
 }
 
 var threeOfAKind = map[int]TrickType{
@@ -61,59 +212,71 @@ type Trick struct {
 	Dice Roll
 }
 
-func (t Trick) Score() uint8 {
-	return trickScores[t.Type]
+// The number of points this trick is worth.
+func (t Trick) Score(rules *ScoringRules) int {
+	if rules.DoubleNOfAKind && isNOfAKind(t.Type) {
+		die := 0
+		for d, count := range t.Dice {
+			if count > 0 {
+				die = d
+			}
+		}
+		doublings := int(t.Type-FourOfAKind) + 1
+		return rules.TrickScores[threeOfAKind[die]] << doublings
+	}
+
+	return rules.TrickScores[t.Type]
 }
 
-func remainingTricks(roll Roll, trick Trick) [][]Trick {
+func remainingTricks(rules *ScoringRules, roll Roll, trick Trick) [][]Trick {
 	result := [][]Trick{{trick}}
 	remainingDice := SubtractRolls(roll, trick.Dice)
-	for _, addlTricks := range enumeratePossibleTricks(remainingDice) {
+	for _, addlTricks := range enumeratePossibleTricks(rules, remainingDice) {
 		result = append(result, append([]Trick{trick}, addlTricks...))
 	}
 	return result
 }
 
-func enumeratePossibleTricks(roll Roll) [][]Trick {
+func enumeratePossibleTricks(rules *ScoringRules, roll Roll) [][]Trick {
 	var result [][]Trick
 	for die, count := range roll {
-		if count >= 1 && (die == 1 || die == 5) {
+		if count >= 1 && (die == 1 || die == 5) && rules.allows(singles[die]) {
 			trick := Trick{
 				Type: singles[die],
 				Dice: NewRoll(uint8(die)),
 			}
 
-			result = append(result, remainingTricks(roll, trick)...)
+			result = append(result, remainingTricks(rules, roll, trick)...)
 		}
 
-		if count >= 3 {
+		if count >= 3 && rules.allows(threeOfAKind[die]) {
 			trick := Trick{
 				Type: threeOfAKind[die],
 				Dice: RepeatedRoll(uint8(die), count),
 			}
 
-			result = append(result, remainingTricks(roll, trick)...)
+			result = append(result, remainingTricks(rules, roll, trick)...)
 		}
 
-		if count >= 4 {
+		if count >= 4 && rules.allows(FourOfAKind) {
 			trick := Trick{
 				Type: FourOfAKind,
 				Dice: RepeatedRoll(uint8(die), count),
 			}
 
-			result = append(result, remainingTricks(roll, trick)...)
+			result = append(result, remainingTricks(rules, roll, trick)...)
 		}
 
-		if count >= 5 {
+		if count >= 5 && rules.allows(FiveOfAKind) {
 			trick := Trick{
 				Type: FiveOfAKind,
 				Dice: RepeatedRoll(uint8(die), count),
 			}
 
-			result = append(result, remainingTricks(roll, trick)...)
+			result = append(result, remainingTricks(rules, roll, trick)...)
 		}
 
-		if count >= 6 {
+		if count >= 6 && rules.allows(SixOfAKind) {
 			trick := Trick{
 				Type: SixOfAKind,
 				Dice: roll,
@@ -123,28 +286,28 @@ func enumeratePossibleTricks(roll Roll) [][]Trick {
 		}
 	}
 
-	if isStraight(roll) {
+	if isStraight(roll) && rules.allows(Straight) {
 		trick := Trick{
 			Type: Straight,
 			Dice: roll,
 		}
 
 		result = append(result, []Trick{trick})
-	} else if isThreePairs(roll) {
+	} else if isThreePairs(roll) && rules.allows(ThreePairs) {
 		trick := Trick{
 			Type: ThreePairs,
 			Dice: roll,
 		}
 
 		result = append(result, []Trick{trick})
-	} else if isFourOfAKindPlusPair(roll) {
+	} else if isFourOfAKindPlusPair(roll) && rules.allows(FourOfAKindPlusPair) {
 		trick := Trick{
 			Type: FourOfAKindPlusPair,
 			Dice: roll,
 		}
 
 		result = append(result, []Trick{trick})
-	} else if isTwoTriplets(roll) {
+	} else if isTwoTriplets(roll) && rules.allows(TwoTriplets) {
 		trick := Trick{
 			Type: TwoTriplets,
 			Dice: roll,
@@ -203,12 +366,13 @@ func isTwoTriplets(roll Roll) bool {
 	return numTriplets >= 2
 }
 
-func CalculateScore(held Roll) uint8 {
-	result := uint8(0)
-	for _, tricks := range enumeratePossibleTricks(held) {
-		score := uint8(0)
+// The score, in points, of the given held dice.
+func CalculateScore(rules *ScoringRules, held Roll) int {
+	result := 0
+	for _, tricks := range enumeratePossibleTricks(rules, held) {
+		score := 0
 		for _, trick := range tricks {
-			score += trick.Score()
+			score += trick.Score(rules)
 		}
 
 		result = max(result, score)
@@ -217,8 +381,8 @@ func CalculateScore(held Roll) uint8 {
 	return result
 }
 
-func potentialHolds(roll Roll) []Roll {
-	trickSets := enumeratePossibleTricks(roll)
+func potentialHolds(rules *ScoringRules, roll Roll) []Roll {
+	trickSets := enumeratePossibleTricks(rules, roll)
 	result := make([]Roll, 0, len(trickSets))
 	for _, tricks := range trickSets {
 		allRolls := make([]Roll, len(tricks))
@@ -233,24 +397,67 @@ func potentialHolds(roll Roll) []Roll {
 	return result
 }
 
-var rollIDToPotentialHolds = func() [][]Roll {
-	var result [][]Roll
+// Lookup tables derived from a set of scoring rules.
+type scoringTables struct {
+	// For each roll ID, the sets of dice that may be held.
+	potentialHolds [][]Roll
+	// For each roll ID, all actions that may be taken.
+	potentialActions [][]Action
+	// For each set of held dice, the total score in points.
+	points []int
+	// The highest score of any set of held dice, in points.
+	maxPoints int
+}
+
+func (rules *ScoringRules) getTables() *scoringTables {
+	rules.once.Do(func() {
+		rules.tables = newScoringTables(rules)
+	})
+	return rules.tables
+}
+
+func newScoringTables(rules *ScoringRules) *scoringTables {
+	for t, score := range rules.TrickScores {
+		if score < 0 {
+			panic(fmt.Errorf("invalid score for %s in %s rules: %d is negative",
+				TrickType(t), rules.Name, score))
+		}
+	}
+
+	var holds [][]Roll
 	for _, rolls := range allRolls {
 		for _, weightedRoll := range rolls {
-			result = append(result, potentialHolds(weightedRoll.Roll))
+			holds = append(holds, potentialHolds(rules, weightedRoll.Roll))
 		}
 	}
-	return result
-}()
 
-func IsFarkle(roll Roll) bool {
-	rollID := rollToID[roll]
-	return len(rollIDToPotentialHolds[rollID]) == 0
+	points := make([]int, nDistinctRolls)
+	for _, rollHolds := range holds {
+		for _, hold := range rollHolds {
+			points[rollToID[hold]] = CalculateScore(rules, hold)
+		}
+	}
+
+	if points[0] != 0 {
+		panic(fmt.Errorf("farkle should have zero score! got %d", points[0]))
+	}
+
+	return &scoringTables{
+		potentialHolds:   holds,
+		potentialActions: makePotentialActions(holds),
+		points:           points,
+		maxPoints:        slices.Max(points),
+	}
+}
+
+func IsFarkle(rules *ScoringRules, roll Roll) bool {
+	rollID := GetRollID(roll)
+	return len(rules.getTables().potentialHolds[rollID]) == 0
 }
 
-func IsValidHold(roll, held Roll) bool {
+func IsValidHold(rules *ScoringRules, roll, held Roll) bool {
 	rollID := GetRollID(roll)
-	potentialHolds := rollIDToPotentialHolds[rollID]
+	potentialHolds := rules.getTables().potentialHolds[rollID]
 	potentialHoldsSet := make(map[Roll]struct{}, len(potentialHolds))
 	for _, hold := range potentialHolds {
 		potentialHoldsSet[hold] = struct{}{}
@@ -260,14 +467,16 @@ func IsValidHold(roll, held Roll) bool {
 	return ok
 }
 
-// For each set of held dice, the total score.
-var scoreCache = func() []uint8 {
-	result := make([]uint8, nDistinctRolls)
-	for _, holds := range rollIDToPotentialHolds {
-		for _, hold := range holds {
-			rollID := rollToID[hold]
-			result[rollID] = CalculateScore(hold)
+// The distinct sets of dice that may be held after the roll,
+// or none if it is a farkle.
+func ValidHolds(rules *ScoringRules, roll Roll) []Roll {
+	var result []Roll
+	seen := make(map[Roll]bool)
+	for _, hold := range rules.getTables().potentialHolds[GetRollID(roll)] {
+		if !seen[hold] {
+			seen[hold] = true
+			result = append(result, hold)
 		}
 	}
 	return result
-}()
+}
@@ -0,0 +1,65 @@
+package farkle
+
+import "testing"
+
+func TestCalculateScorePresets(t *testing.T) {
+	testCases := []struct {
+		scoring *ScoringRules
+		held    Roll
+		want    int
+	}{
+		{StandardScoring, NewRoll(1), 100},
+		{StandardScoring, NewRoll(5), 50},
+		{StandardScoring, NewRoll(1, 1, 5), 250},
+		{StandardScoring, NewRoll(1, 1, 1), 300},
+		{StandardScoring, NewRoll(1, 1, 1, 1), 1000},
+		{StandardScoring, NewRoll(2, 2, 2, 2, 2, 2), 3000},
+		{StandardScoring, NewRoll(1, 2, 3, 4, 5, 6), 1500},
+		{StandardScoring, NewRoll(2, 2, 3, 3, 4, 4), 1500},
+		{StandardScoring, NewRoll(2, 2, 2, 3, 3, 3), 2500},
+		{ClassicScoring, NewRoll(1, 1, 1), 1000},
+		{ClassicScoring, NewRoll(1, 1, 1, 1), 1100},
+		{ClassicScoring, NewRoll(2, 2, 2), 200},
+		{DoublingScoring, NewRoll(1, 2, 3, 4, 5, 6), 2500},
+		{DoublingScoring, NewRoll(5), 50},
+	}
+
+	for _, tc := range testCases {
+		if got := CalculateScore(tc.scoring, tc.held); got != tc.want {
+			t.Errorf("%v: score of %v = %d, expected %d", tc.scoring, tc.held, got, tc.want)
+		}
+	}
+}
+
+func TestDoubleNOfAKind(t *testing.T) {
+	testCases := []struct {
+		held Roll
+		want int
+	}{
+		{NewRoll(2, 2, 2), 200},
+		{NewRoll(2, 2, 2, 2), 400},
+		{NewRoll(2, 2, 2, 2, 2), 800},
+		{NewRoll(4, 4, 4, 4, 4, 4), 3200},
+		// Three 1s and a single 1 are worth less than four 1s.
+		{NewRoll(1, 1, 1, 1), 600},
+		// Six of a kind is not two triplets.
+		{NewRoll(3, 3, 3, 3, 3, 3), 2400},
+	}
+
+	for _, tc := range testCases {
+		if got := CalculateScore(DoublingScoring, tc.held); got != tc.want {
+			t.Errorf("score of %v = %d, expected %d", tc.held, got, tc.want)
+		}
+	}
+
+	// The FourOfAKind to SixOfAKind scores are ignored.
+	scoring := &ScoringRules{
+		Name:           "ignored",
+		TrickScores:    DoublingScoring.TrickScores,
+		DoubleNOfAKind: true,
+	}
+	scoring.TrickScores[FourOfAKind] = 10000
+	if got := CalculateScore(scoring, NewRoll(2, 2, 2, 2)); got != 400 {
+		t.Errorf("score of four 2s = %d, expected 400", got)
+	}
+}
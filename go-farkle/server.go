@@ -0,0 +1,282 @@
+package farkle
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// Server answers JSON queries about the optimal strategy
+// using a solution database.
+//
+// GET /rules returns the rules the database was solved with.
+//
+// GET or POST /query evaluates a game state, given either as URL
+// query parameters or as a JSON QueryRequest in the request body.
+// For example:
+//
+//	/query?scores=1500,2000&score_this_round=300&num_dice_to_roll=4&roll=1125
+type Server struct {
+	rules *Rules
+	db    DB
+	mux   *http.ServeMux
+}
+
+func NewServer(rules *Rules, db DB) *Server {
+	s := &Server{
+		rules: rules,
+		db:    db,
+		mux:   http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /rules", s.handleRules)
+	s.mux.HandleFunc("GET /query", s.handleQuery)
+	s.mux.HandleFunc("POST /query", s.handleQuery)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// A game state to evaluate. All scores are in points.
+type QueryRequest struct {
+	// Banked score of each player, starting with the current player
+	// and in order of play.
+	Scores []int `json:"scores"`
+	// Points accumulated by the current player this turn.
+	ScoreThisRound int `json:"score_this_round"`
+	// Number of dice the current player is about to roll,
+	// or has rolled. Defaults to MaxNumDice.
+	NumDiceToRoll int `json:"num_dice_to_roll"`
+	// Number of turns in a row each player has farkled,
+	// if the rules have a farkle penalty.
+	ConsecutiveFarkles []int `json:"consecutive_farkles,omitempty"`
+	// Dice rolled by the current player, e.g. "1125". If empty,
+	// the state is evaluated before rolling.
+	Roll string `json:"roll,omitempty"`
+}
+
+// The value of an action taken after rolling.
+type ActionValue struct {
+	// Dice held, e.g. "15". Empty if the roll was a farkle.
+	Held            string `json:"held"`
+	ContinueRolling bool   `json:"continue_rolling"`
+	// Points accumulated this turn after holding the dice.
+	ScoreThisRound int `json:"score_this_round"`
+	// Win probability of each player if this action is taken,
+	// in the same order as QueryRequest.Scores.
+	WinProbability []float64 `json:"win_probability"`
+	// Difference between the current player's win probability
+	// with this action and with the best action.
+	Delta float64 `json:"delta"`
+}
+
+type QueryResponse struct {
+	State    string `json:"state"`
+	GameOver bool   `json:"game_over"`
+	Farkle   bool   `json:"farkle"`
+	// Win probability of each player with optimal play, in the same
+	// order as QueryRequest.Scores. If a roll was given, this is the
+	// value of the best action.
+	WinProbability []float64 `json:"win_probability"`
+	// The best action for the given roll.
+	BestAction *ActionValue `json:"best_action,omitempty"`
+	// All legal actions for the given roll, best first.
+	Options []ActionValue `json:"options,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, struct {
+		NumPlayers int
+		Rules      *Rules
+	}{s.db.NumPlayers(), s.rules})
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	var req QueryRequest
+	var err error
+	if r.Method == http.MethodPost {
+		err = json.NewDecoder(r.Body).Decode(&req)
+	} else {
+		req, err = parseQueryParams(r)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{err.Error()})
+		return
+	}
+
+	resp, err := s.Query(req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Evaluate the game state described by the request.
+func (s *Server) Query(req QueryRequest) (QueryResponse, error) {
+	state, err := s.parseState(req)
+	if err != nil {
+		return QueryResponse{}, err
+	}
+
+	n := int(state.NumPlayers)
+	resp := QueryResponse{
+		State:    s.rules.FormatState(state),
+		GameOver: state.IsGameOver(s.rules),
+	}
+	if resp.GameOver || req.Roll == "" {
+		pWin := s.db.Get(state)
+		resp.WinProbability = pWin[:n]
+		return resp, nil
+	}
+
+	roll, err := ParseRoll(req.Roll)
+	if err != nil {
+		return QueryResponse{}, err
+	}
+	if roll.NumDice() != state.NumDiceToRoll {
+		return QueryResponse{}, fmt.Errorf("rolled %d dice, expected %d",
+			roll.NumDice(), state.NumDiceToRoll)
+	}
+
+	ranked := RankActions(s.rules, state, GetRollID(roll), s.db)
+	resp.Farkle = IsFarkle(s.rules.Scoring, roll)
+	resp.WinProbability = ranked[0].WinProb[:n]
+	for _, ra := range ranked {
+		resp.Options = append(resp.Options, s.actionValue(state, ra))
+	}
+	resp.BestAction = &resp.Options[0]
+
+	return resp, nil
+}
+
+func (s *Server) actionValue(state GameState, action RankedAction) ActionValue {
+	held := ""
+	for _, die := range rollsByID[action.HeldDiceID].Dice() {
+		held += strconv.Itoa(int(die))
+	}
+
+	score := 0
+	if action.HeldDiceID != 0 {
+		newState := ApplyAction(s.rules, state, Action{HeldDiceID: action.HeldDiceID, ContinueRolling: true})
+		score = s.rules.Points(newState.ScoreThisRound)
+	}
+
+	return ActionValue{
+		Held:            held,
+		ContinueRolling: action.ContinueRolling,
+		ScoreThisRound:  score,
+		WinProbability:  action.WinProb[:state.NumPlayers],
+		Delta:           action.Delta,
+	}
+}
+
+// Convert a request into a game state, checking that it is
+// valid for the database being served.
+func (s *Server) parseState(req QueryRequest) (GameState, error) {
+	numPlayers := s.db.NumPlayers()
+	if len(req.Scores) != numPlayers {
+		return GameState{}, fmt.Errorf("got %d scores for %d-player game",
+			len(req.Scores), numPlayers)
+	}
+
+	state := NewGameState(numPlayers)
+	for i, score := range req.Scores {
+		units, err := s.rules.ScoreUnits(score)
+		if err != nil {
+			return GameState{}, fmt.Errorf("score of player %d: %w", i, err)
+		}
+		state.PlayerScores[i] = units
+	}
+
+	units, err := s.rules.ScoreUnits(req.ScoreThisRound)
+	if err != nil {
+		return GameState{}, fmt.Errorf("score this round: %w", err)
+	}
+	state.ScoreThisRound = units
+
+	if req.NumDiceToRoll != 0 {
+		if req.NumDiceToRoll < 1 || req.NumDiceToRoll > MaxNumDice {
+			return GameState{}, fmt.Errorf("number of dice to roll must be 1-%d, got %d",
+				MaxNumDice, req.NumDiceToRoll)
+		}
+		state.NumDiceToRoll = uint8(req.NumDiceToRoll)
+	}
+
+	if len(req.ConsecutiveFarkles) > 0 {
+		if s.rules.FarklePenalty == 0 {
+			return GameState{}, fmt.Errorf("consecutive farkles are only tracked with a farkle penalty")
+		}
+		if len(req.ConsecutiveFarkles) != numPlayers {
+			return GameState{}, fmt.Errorf("got %d consecutive farkle counts for %d-player game",
+				len(req.ConsecutiveFarkles), numPlayers)
+		}
+		for i, farkles := range req.ConsecutiveFarkles {
+			if farkles < 0 || farkles >= NumFarklesForPenalty {
+				return GameState{}, fmt.Errorf("consecutive farkles must be 0-%d, got %d",
+					NumFarklesForPenalty-1, farkles)
+			}
+			state.ConsecutiveFarkles[i] = uint8(farkles)
+		}
+	}
+
+	return state, nil
+}
+
+func parseQueryParams(r *http.Request) (QueryRequest, error) {
+	params := r.URL.Query()
+	var req QueryRequest
+	var err error
+	if req.Scores, err = parseIntList(params.Get("scores")); err != nil {
+		return req, fmt.Errorf("invalid scores: %w", err)
+	}
+	if req.ConsecutiveFarkles, err = parseIntList(params.Get("consecutive_farkles")); err != nil {
+		return req, fmt.Errorf("invalid consecutive_farkles: %w", err)
+	}
+	if v := params.Get("score_this_round"); v != "" {
+		if req.ScoreThisRound, err = strconv.Atoi(v); err != nil {
+			return req, fmt.Errorf("invalid score_this_round: %w", err)
+		}
+	}
+	if v := params.Get("num_dice_to_roll"); v != "" {
+		if req.NumDiceToRoll, err = strconv.Atoi(v); err != nil {
+			return req, fmt.Errorf("invalid num_dice_to_roll: %w", err)
+		}
+	}
+	req.Roll = params.Get("roll")
+	return req, nil
+}
+
+// Parse a comma-separated list of integers.
+func parseIntList(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var result []int
+	for _, field := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		glog.Warningf("Error writing response: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package farkle
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestServerQuery(t *testing.T) {
+	db := NewMemDB(tinyRules, tinyNumPlayers)
+	solveTiny(t, db, tinyGameStates(t))
+	ts := httptest.NewServer(NewServer(tinyRules, db))
+	defer ts.Close()
+
+	testCases := []struct {
+		name string
+		// Query parameters for a GET, or a JSON body for a POST.
+		query, body string
+		check       func(t *testing.T, resp QueryResponse)
+	}{
+		{
+			name:  "initial state",
+			query: "scores=0,0",
+			check: func(t *testing.T, resp QueryResponse) {
+				if resp.GameOver || resp.BestAction != nil || len(resp.Options) != 0 {
+					t.Errorf("expected only win probabilities, got %+v", resp)
+				}
+			},
+		},
+		{
+			name:  "roll",
+			query: "scores=100,0&score_this_round=100&num_dice_to_roll=3&roll=155",
+			check: func(t *testing.T, resp QueryResponse) {
+				if resp.Farkle || len(resp.Options) == 0 || resp.BestAction == nil {
+					t.Fatalf("expected options for roll, got %+v", resp)
+				}
+				if !reflect.DeepEqual(*resp.BestAction, resp.Options[0]) || resp.BestAction.Delta != 0 {
+					t.Errorf("best action %+v is not the first option %+v", *resp.BestAction, resp.Options[0])
+				}
+				for _, option := range resp.Options {
+					if option.Delta > 0 || option.ScoreThisRound <= 100 {
+						t.Errorf("invalid option %+v", option)
+					}
+				}
+			},
+		},
+		{
+			name: "farkle",
+			body: `{"scores": [100, 0], "score_this_round": 100, "num_dice_to_roll": 3, "roll": "234"}`,
+			check: func(t *testing.T, resp QueryResponse) {
+				if !resp.Farkle || len(resp.Options) != 1 || resp.Options[0].Held != "" {
+					t.Errorf("expected a farkle, got %+v", resp)
+				}
+			},
+		},
+		{
+			name:  "game over",
+			query: "scores=300,200",
+			check: func(t *testing.T, resp QueryResponse) {
+				if !resp.GameOver || resp.WinProbability[0] != 1 || resp.WinProbability[1] != 0 {
+					t.Errorf("expected a win for the current player, got %+v", resp)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var resp QueryResponse
+			status := doQuery(t, ts, tc.query, tc.body, &resp)
+			if status != http.StatusOK {
+				t.Fatalf("got status %d, expected %d", status, http.StatusOK)
+			}
+			if len(resp.WinProbability) != tinyNumPlayers ||
+				math.Abs(resp.WinProbability[0]+resp.WinProbability[1]-1) > 1e-9 {
+				t.Errorf("invalid win probabilities: %v", resp.WinProbability)
+			}
+			tc.check(t, resp)
+		})
+	}
+}
+
+func TestServerQueryInvalid(t *testing.T) {
+	ts := httptest.NewServer(NewServer(tinyRules, NewMemDB(tinyRules, tinyNumPlayers)))
+	defer ts.Close()
+
+	testCases := []struct {
+		name, query, body string
+	}{
+		{name: "no scores", query: ""},
+		{name: "malformed scores", query: "scores=0,abc"},
+		{name: "score not a multiple of the increment", query: "scores=150,0"},
+		{name: "negative score", query: "scores=-100,0"},
+		{name: "too many players", query: "scores=0,0,0"},
+		{name: "too many dice", query: "scores=0,0&num_dice_to_roll=7"},
+		{name: "malformed roll", query: "scores=0,0&roll=17"},
+		{name: "wrong number of dice rolled", query: "scores=0,0&num_dice_to_roll=3&roll=11"},
+		{name: "malformed body", body: `{"scores": [0, 0]`},
+		{name: "too many players in body", body: `{"scores": [0, 0, 0]}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var resp errorResponse
+			status := doQuery(t, ts, tc.query, tc.body, &resp)
+			if status != http.StatusBadRequest {
+				t.Errorf("got status %d, expected %d", status, http.StatusBadRequest)
+			}
+			if resp.Error == "" {
+				t.Errorf("expected an error message")
+			}
+		})
+	}
+}
+
+// Query the server, with a POST if body is non-empty and otherwise a GET,
+// decoding the JSON response into v and returning the status code.
+func doQuery(t *testing.T, ts *httptest.Server, query, body string, v any) int {
+	t.Helper()
+	var resp *http.Response
+	var err error
+	if body != "" {
+		resp, err = http.Post(ts.URL+"/query", "application/json", strings.NewReader(body))
+	} else {
+		resp, err = http.Get(ts.URL + "/query?" + query)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("got content type %q, expected JSON", contentType)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	return resp.StatusCode
+}
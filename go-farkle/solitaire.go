@@ -0,0 +1,353 @@
+package farkle
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// SolitaireTable is the solution of Farkle as a single player game, in
+// which a player either maximizes the points banked in a turn, or
+// minimizes the number of turns needed to reach the score to win.
+// Unlike the multiplayer solver, it does not depend on any opponent's
+// score, so it is small enough to compute on the fly.
+// The farkle penalty is ignored.
+type SolitaireTable struct {
+	rules *Rules
+	rolls *turnRolls
+	// Expected points banked by the end of the turn with optimal play,
+	// indexed by [on board][score this round][dice to roll].
+	points [2]turnTable
+	// Expected number of turns needed to reach the score to win with
+	// optimal play, indexed by [banked score][score this round][dice to roll].
+	// Only computed by SolveTurns.
+	turns []turnTable
+}
+
+// Value of a turn, indexed by [score this round][dice to roll].
+type turnTable [][MaxNumDice + 1]float64
+
+// The non-farkle rolls of each number of dice, and the distinct
+// outcomes of the possible holds for each of them, for solving
+// a single turn.
+type turnRolls [MaxNumDice + 1]solitaireRolls
+
+type solitaireRolls struct {
+	pFarkle float64
+	rolls   []solitaireRoll
+}
+
+type solitaireRoll struct {
+	prob  float64
+	holds []solitaireHold
+}
+
+type solitaireHold struct {
+	score       uint16
+	numDiceLeft uint8
+}
+
+// Solve for the expected points banked in a turn.
+func NewSolitaireTable(rules *Rules) *SolitaireTable {
+	t := &SolitaireTable{rules: rules, rolls: newTurnRolls(rules)}
+	for onBoard := range t.points {
+		stopValues := make([]float64, rules.numScores())
+		for score := range stopValues {
+			stopValues[score] = float64(rules.Points(uint16(score)))
+			if onBoard == 0 && score < int(rules.minOpeningScore()) {
+				stopValues[score] = math.NaN()
+			}
+		}
+		t.points[onBoard], _ = t.rolls.solveTurn(stopValues, 0, false)
+	}
+
+	return t
+}
+
+func newTurnRolls(rules *Rules) *turnRolls {
+	var rolls turnRolls
+	tables := rules.Scoring.getTables()
+	for numDice := 1; numDice <= MaxNumDice; numDice++ {
+		for _, wRoll := range allRolls[numDice] {
+			actions := tables.potentialActions[wRoll.ID]
+			if len(actions) == 0 {
+				rolls[numDice].pFarkle += wRoll.Prob
+				continue
+			}
+
+			seen := make(map[solitaireHold]bool, len(actions))
+			roll := solitaireRoll{prob: wRoll.Prob}
+			for _, action := range actions {
+				hold := solitaireHold{
+					score:       rules.heldScore(action.HeldDiceID),
+					numDiceLeft: uint8(numDice) - rollNumDice[action.HeldDiceID],
+				}
+				if hold.numDiceLeft == 0 {
+					hold.numDiceLeft = MaxNumDice
+				}
+				if !seen[hold] {
+					seen[hold] = true
+					roll.holds = append(roll.holds, hold)
+				}
+			}
+			rolls[numDice].rolls = append(rolls[numDice].rolls, roll)
+		}
+	}
+	return &rolls
+}
+
+// Solve a single turn backwards from the highest score this round, since
+// every hold increases it. Banking a score this round is worth
+// stopValues[score], or NaN if the player may not stop with that score,
+// and farkling is worth farkleValue. There is a stop value for every score
+// this round up to the highest that can be represented. Values are
+// maximized, or minimized if minimize is true. Also returns the derivative
+// of each value with respect to farkleValue, i.e. the probability of
+// farkling with the optimal policy.
+func (rolls *turnRolls) solveTurn(stopValues []float64, farkleValue float64, minimize bool) (turnTable, turnTable) {
+	better := func(a, b float64) bool {
+		if minimize {
+			return a < b
+		}
+		return a > b
+	}
+
+	maxScore := len(stopValues) - 1
+	values := make(turnTable, len(stopValues))
+	pFarkle := make(turnTable, len(stopValues))
+	for score := maxScore; score >= 0; score-- {
+		for numDice := 1; numDice <= MaxNumDice; numDice++ {
+			dice := &rolls[numDice]
+			value := dice.pFarkle * farkleValue
+			p := dice.pFarkle
+			for _, roll := range dice.rolls {
+				bestValue, bestP := math.NaN(), 0.0
+				for _, hold := range roll.holds {
+					newScore := min(score+int(hold.score), maxScore)
+					if v := stopValues[newScore]; !math.IsNaN(v) {
+						if math.IsNaN(bestValue) || better(v, bestValue) {
+							bestValue, bestP = v, 0
+						}
+					}
+					if newScore < maxScore {
+						// Once the score this round overflows, continuing
+						// is approximated as stopping, as in the solver.
+						v := values[newScore][hold.numDiceLeft]
+						if math.IsNaN(bestValue) || better(v, bestValue) {
+							bestValue, bestP = v, pFarkle[newScore][hold.numDiceLeft]
+						}
+					}
+				}
+				value += roll.prob * bestValue
+				p += roll.prob * bestP
+			}
+			values[score][numDice] = value
+			pFarkle[score][numDice] = p
+		}
+	}
+
+	return values, pFarkle
+}
+
+// Probability of scoring at least each number of points in a turn, in
+// units of the score increment, playing to maximize it. The score this
+// round is capped at numScores-1, so the probability of reaching
+// numScores is 0. Solved upwards from 0 since every hold scores.
+func (rolls *turnRolls) reachProbs(numScores int) []float64 {
+	// Indexed by [points needed][dice to roll].
+	pReach := make([][MaxNumDice + 1]float64, numScores+1)
+	for numDice := 1; numDice <= MaxNumDice; numDice++ {
+		pReach[0][numDice] = 1
+	}
+	for need := 1; need < numScores; need++ {
+		for numDice := 1; numDice <= MaxNumDice; numDice++ {
+			for _, roll := range rolls[numDice].rolls {
+				best := 0.0
+				for _, hold := range roll.holds {
+					left := max(need-int(hold.score), 0)
+					best = max(best, pReach[left][hold.numDiceLeft])
+				}
+				pReach[need][numDice] += roll.prob * best
+			}
+		}
+	}
+
+	result := make([]float64, numScores+1)
+	for need := range result {
+		result[need] = pReach[need][MaxNumDice]
+	}
+	return result
+}
+
+// Solve for the expected number of turns to reach the score to win from
+// every banked score. This takes several seconds with the default rules.
+func (t *SolitaireTable) SolveTurns() {
+	target := int(t.rules.scoreToWin())
+	t.turns = make([]turnTable, target)
+	// Expected number of turns from each banked score, at the start of a turn.
+	turnsFrom := func(banked int) float64 {
+		if banked >= target {
+			return 0
+		}
+		return 1 + t.turns[banked][0][MaxNumDice]
+	}
+
+	for banked := target - 1; banked >= 0; banked-- {
+		// Banking the points still needed to win is always best, so
+		// higher scores this round are equivalent and not tracked.
+		stopValues := make([]float64, target-banked+1)
+		stopValues[0] = math.NaN() // Every hold scores.
+		for score := 1; score < len(stopValues); score++ {
+			stopValues[score] = turnsFrom(banked + score)
+			if banked == 0 && score < int(t.rules.minOpeningScore()) {
+				stopValues[score] = math.NaN()
+			}
+		}
+
+		// Farkling wastes a turn and starts over from the same banked
+		// score, so the expected number of turns T satisfies
+		// T = 1 + value(T), which is solved with Newton's method.
+		farkleTurns := 1.0
+		if banked+1 < target {
+			farkleTurns = turnsFrom(banked + 1)
+		}
+		for i := 0; i < 100; i++ {
+			values, pFarkle := t.rolls.solveTurn(stopValues, farkleTurns, true)
+			t.turns[banked] = values
+			g := 1 + values[0][MaxNumDice] - farkleTurns
+			next := farkleTurns - g/(pFarkle[0][MaxNumDice]-1)
+			if math.Abs(next-farkleTurns) < 1e-12 {
+				break
+			}
+			farkleTurns = next
+		}
+	}
+}
+
+// Expected points banked by the end of the turn, with optimal play, before
+// rolling in the given state. Only the current player's score matters.
+func (t *SolitaireTable) ExpectedPoints(state GameState) float64 {
+	return t.points[boolToInt(state.CurrentPlayerScore() > 0)][state.ScoreThisRound][state.NumDiceToRoll]
+}
+
+// Expected number of turns, including this one, needed to reach the score
+// to win with optimal play, before rolling in the given state.
+// SolveTurns must have been called.
+func (t *SolitaireTable) ExpectedTurns(state GameState) float64 {
+	banked := int(state.CurrentPlayerScore())
+	if banked >= len(t.turns) {
+		return 0
+	}
+	turns := t.turns[banked]
+	score := min(int(state.ScoreThisRound), len(turns)-1)
+	return 1 + turns[score][state.NumDiceToRoll]
+}
+
+// Write the expected points banked in a turn from every state as CSV.
+// Scores are in points.
+func (t *SolitaireTable) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"on_board", "score_this_round", "num_dice_to_roll", "expected_points"}); err != nil {
+		return err
+	}
+	for onBoard := range t.points {
+		for score := range t.points[onBoard] {
+			for numDice := 1; numDice <= MaxNumDice; numDice++ {
+				err := cw.Write([]string{
+					strconv.Itoa(onBoard),
+					strconv.Itoa(t.rules.Points(uint16(score))),
+					strconv.Itoa(numDice),
+					strconv.FormatFloat(t.points[onBoard][score][numDice], 'f', 4, 64),
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// SolitaireAction is a legal action and its value in solitaire play.
+type SolitaireAction struct {
+	Action
+	// Expected points banked this turn if this action is taken,
+	// with optimal play afterwards.
+	ExpectedPoints float64
+	// Difference between the expected points of this action
+	// and the best action, always <= 0.
+	Delta float64
+}
+
+type SolitaireActions []SolitaireAction
+
+// All distinct legal actions for the given roll, sorted by expected
+// points banked this turn, best first. Legal actions are the same as for
+// RankActions. If the roll is a farkle, the only action is the zero Action.
+func (t *SolitaireTable) RankActions(state GameState, roll Roll) SolitaireActions {
+	potentialActions := t.rules.Scoring.getTables().potentialActions[GetRollID(roll)]
+	if len(potentialActions) == 0 {
+		return SolitaireActions{{}}
+	}
+
+	onBoard := boolToInt(state.CurrentPlayerScore() > 0)
+	result := make(SolitaireActions, 0, len(potentialActions))
+	seen := make(map[Action]bool, len(potentialActions))
+	for _, action := range potentialActions {
+		if state.ScoreThisRound == t.rules.maxScore() && action.ContinueRolling {
+			// Overflowed score this round, approximated as stopping.
+			action.ContinueRolling = false
+		}
+		if seen[action] || (!action.ContinueRolling && !t.rules.CanStop(state, action.HeldDiceID)) {
+			continue
+		}
+		seen[action] = true
+
+		newState := ApplyAction(t.rules, state, Action{HeldDiceID: action.HeldDiceID, ContinueRolling: true})
+		value := float64(t.rules.Points(newState.ScoreThisRound))
+		if action.ContinueRolling {
+			value = t.points[onBoard][newState.ScoreThisRound][newState.NumDiceToRoll]
+		}
+		result = append(result, SolitaireAction{Action: action, ExpectedPoints: value})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].ExpectedPoints > result[j].ExpectedPoints
+	})
+	for i := range result {
+		result[i].Delta = result[i].ExpectedPoints - result[0].ExpectedPoints
+	}
+	return result
+}
+
+// The ranking of the given action, or false if it is not legal.
+// As for RankedActions, an action that continues rolling after the
+// score this round has overflowed matches the equivalent action that stops.
+func (ranked SolitaireActions) Find(action Action) (SolitaireAction, bool) {
+	for _, sa := range ranked {
+		if sa.Action == action {
+			return sa, true
+		}
+	}
+
+	if action.ContinueRolling {
+		action.ContinueRolling = false
+		for _, sa := range ranked {
+			if sa.Action == action {
+				return sa, true
+			}
+		}
+	}
+
+	return SolitaireAction{}, false
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,122 @@
+package farkle
+
+import "fmt"
+
+// Strategy decides how a player plays their turn. Strategies may be
+// shared by games played concurrently, so must be safe for concurrent use.
+type Strategy interface {
+	// Choose the dice to hold after rolling at the given table, and
+	// whether to continue rolling. The roll is never a farkle, and the
+	// action must be legal: the held dice must be a valid hold, and
+	// the player may only stop if the rules allow it.
+	//
+	// The table rather than a GameState is passed so that games with
+	// more players than a GameState holds can be played, e.g. with an
+	// approximate solution. Use Table.GameState to solve exactly.
+	ChooseAction(table Table, roll Roll) Action
+}
+
+// Strategy that plays optimally according to a solution database,
+// in games with few enough players to be solved exactly.
+type DBStrategy struct {
+	rules *Rules
+	db    DB
+}
+
+func NewDBStrategy(rules *Rules, db DB) *DBStrategy {
+	return &DBStrategy{rules: rules, db: db}
+}
+
+func (s *DBStrategy) ChooseAction(table Table, roll Roll) Action {
+	action, _ := SelectAction(s.rules, table.GameState(), GetRollID(roll), s.db)
+	return action
+}
+
+// GameResult is the outcome of a game, with one entry per seat
+// in order of play.
+type GameResult struct {
+	// Final score of each seat, in points.
+	Scores []int
+	// Share of the win of each seat. A tie for the highest score is
+	// valued by the TieBreak policy of the rules. With SuddenDeath, the
+	// extra round is not played: each tied seat gets its expected share.
+	Wins []float64
+	// Number of turns taken by each seat.
+	NumTurns []int
+}
+
+// Play a game between the given strategies, one per seat in order
+// of play, rolling dice from the given source. A game that ends in a
+// tie is not played out further; see GameResult.Wins. It is an error
+// if the dice source fails, e.g. because a script runs out.
+func PlayGame(rules *Rules, strategies []Strategy, dice DiceSource) (GameResult, error) {
+	result, _, err := playGame(rules, strategies, dice, false)
+	return result, err
+}
+
+// Like PlayGame, but also returns a record of every roll.
+func PlayRecordedGame(rules *Rules, strategies []Strategy, dice DiceSource) (GameResult, []RecordedRoll, error) {
+	return playGame(rules, strategies, dice, true)
+}
+
+func playGame(rules *Rules, strategies []Strategy, dice DiceSource, record bool) (GameResult, []RecordedRoll, error) {
+	n := len(strategies)
+	result := GameResult{
+		Scores:   make([]int, n),
+		Wins:     make([]float64, n),
+		NumTurns: make([]int, n),
+	}
+
+	var rolls []RecordedRoll
+	table := NewTable(n)
+	seat := 0
+	for !table.IsGameOver(rules) {
+		roll, err := RollDice(dice, int(table.NumDiceToRoll))
+		if err != nil {
+			return GameResult{}, nil, err
+		}
+
+		var action Action
+		if !IsFarkle(rules.Scoring, roll) {
+			action = strategies[seat].ChooseAction(table, roll)
+			checkLegalAction(rules, table, roll, action)
+		}
+		if record {
+			rolls = append(rolls, NewRecordedRoll(rules, table, seat, roll, action))
+		}
+
+		table = ApplyTableAction(rules, table, action)
+		if !action.ContinueRolling {
+			result.NumTurns[seat]++
+			seat = (seat + 1) % n
+		}
+	}
+
+	// The current player at the final table is in the current seat.
+	pWin := calcTableEndGameValue(rules, table)
+	for i := 0; i < n; i++ {
+		result.Scores[(seat+i)%n] = rules.Points(table.PlayerScores[i])
+		result.Wins[(seat+i)%n] = pWin[i]
+	}
+
+	return result, rolls, nil
+}
+
+func checkLegalAction(rules *Rules, table Table, roll Roll, action Action) {
+	if err := legalActionError(rules, table, roll, action); err != nil {
+		panic(err)
+	}
+}
+
+// Check that the action is legal after a roll that is not a farkle.
+func legalActionError(rules *Rules, table Table, roll Roll, action Action) error {
+	held := rollsByID[action.HeldDiceID]
+	if !IsValidHold(rules.Scoring, roll, held) {
+		return fmt.Errorf("illegal action %v for roll %v: not a valid hold", action, roll)
+	}
+	if !action.ContinueRolling && !table.CanStop(rules, action.HeldDiceID) {
+		return fmt.Errorf("illegal action %v for roll %v in state %s: must continue rolling",
+			action, roll, rules.FormatTable(table))
+	}
+	return nil
+}
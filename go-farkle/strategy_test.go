@@ -0,0 +1,124 @@
+package farkle
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Rules for short games that end after a single good roll.
+var shortGameRules = &Rules{
+	Scoring:         StandardScoring,
+	ScoreToWin:      1000,
+	MinOpeningScore: 500,
+}
+
+func thresholdStrategies(rules *Rules, n int) []Strategy {
+	strategies := make([]Strategy, n)
+	for i := range strategies {
+		strategies[i] = &ThresholdStrategy{Rules: rules, Threshold: 500}
+	}
+	return strategies
+}
+
+func TestPlayRecordedGameSeededIsReproducible(t *testing.T) {
+	rules := DefaultRules
+	greedy, err := NewHeuristicStrategy(rules, "greedy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	strategies := []Strategy{greedy, &ThresholdStrategy{Rules: rules, Threshold: 300}}
+
+	var records [2][]byte
+	for i := range records {
+		_, rolls, err := PlayRecordedGame(rules, strategies, NewSeededDice(42))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		err = NewGameRecordWriter(&buf).WriteGame(GameRecord{
+			Header: GameRecordHeader{
+				Rules:      rules,
+				NumPlayers: len(strategies),
+				Dice:       "seed:42",
+			},
+			Rolls: rolls,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		records[i] = buf.Bytes()
+	}
+
+	if len(records[0]) == 0 || !bytes.Equal(records[0], records[1]) {
+		t.Errorf("games with the same seed differ:\n%s\n%s", records[0], records[1])
+	}
+}
+
+func TestPlayGameScripted(t *testing.T) {
+	dice := NewScriptedDice(
+		// Seat 0 rolls a straight and banks 1500, starting the final round.
+		1, 2, 3, 4, 5, 6,
+		// Seat 1 farkles, which ends the game.
+		2, 2, 3, 3, 4, 6,
+	)
+	result, err := PlayGame(shortGameRules, thresholdStrategies(shortGameRules, 2), dice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := GameResult{
+		Scores:   []int{1500, 0},
+		Wins:     []float64{1, 0},
+		NumTurns: []int{1, 1},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got result %+v, expected %+v", result, expected)
+	}
+	if n := dice.Remaining(); n != 0 {
+		t.Errorf("%d scripted dice were not rolled", n)
+	}
+}
+
+func TestPlayGameScriptExhausted(t *testing.T) {
+	// Seat 1 has no dice left to roll in the final round.
+	dice := NewScriptedDice(1, 2, 3, 4, 5, 6)
+	_, err := PlayGame(shortGameRules, thresholdStrategies(shortGameRules, 2), dice)
+	if !errors.Is(err, ErrDiceExhausted) {
+		t.Errorf("got error %v, expected %v", err, ErrDiceExhausted)
+	}
+}
+
+func TestDBStrategyTiesLose(t *testing.T) {
+	// Scores are capped one roll above the score to win, so a player
+	// chasing an opponent at the cap can at best tie, which loses.
+	rules := &Rules{
+		Scoring: &ScoringRules{
+			Name:        "ones",
+			TrickScores: [numTrickTypes]int{Single1: 100},
+		},
+		ScoreToWin:     100,
+		ScoreIncrement: 100,
+		TieBreak:       TiesLose,
+	}
+	db := NewMemDB(rules, 2)
+	solveGame(t, rules, 2, db, gameStatesFile(t, rules, 2))
+	strategy := NewDBStrategy(rules, db)
+
+	table := NewTable(2)
+	table.PlayerScores[1] = rules.maxScore()
+	roll := NewRoll(1, 2, 2, 3, 3, 4)
+	action := strategy.ChooseAction(table, roll)
+	if err := legalActionError(rules, table, roll, action); err != nil {
+		t.Errorf("chose illegal action when every action loses: %v", err)
+	}
+
+	for seed := int64(0); seed < 100; seed++ {
+		_, err := PlayGame(rules, []Strategy{strategy, strategy}, NewSeededDice(seed))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package farkle
+
+import "fmt"
+
+// Most players in a game that can be played. Games with more than
+// 4 players cannot be solved exactly, but can be played with an
+// approximate solution or a heuristic strategy.
+const MaxNumPlayers = maxNumApproxPlayers
+
+// Table is the state of a game as it is played. It is like a GameState,
+// but may have up to MaxNumPlayers players. The current player is always
+// player 0. Scores are in units of the score increment of the Rules.
+type Table struct {
+	ScoreThisRound uint16
+	NumDiceToRoll  uint8
+	NumPlayers     uint8
+	PlayerScores   [MaxNumPlayers]uint16
+	// Number of turns in a row that each player has farkled.
+	// Only tracked if the rules have a FarklePenalty.
+	ConsecutiveFarkles [MaxNumPlayers]uint8
+}
+
+func NewTable(numPlayers int) Table {
+	if numPlayers > MaxNumPlayers {
+		panic(fmt.Errorf("too many players: %d > maximum %d",
+			numPlayers, MaxNumPlayers))
+	}
+
+	return Table{
+		NumDiceToRoll: MaxNumDice,
+		NumPlayers:    uint8(numPlayers),
+	}
+}
+
+// The table in the given game state.
+func (gs GameState) Table() Table {
+	t := Table{
+		ScoreThisRound: gs.ScoreThisRound,
+		NumDiceToRoll:  gs.NumDiceToRoll,
+		NumPlayers:     gs.NumPlayers,
+	}
+	copy(t.PlayerScores[:], gs.PlayerScores[:])
+	copy(t.ConsecutiveFarkles[:], gs.ConsecutiveFarkles[:])
+	return t
+}
+
+// The game state of this table, which must have few enough
+// players to be solved exactly.
+func (t Table) GameState() GameState {
+	if t.NumPlayers > maxNumPlayers {
+		panic(fmt.Errorf("cannot solve a game with %d players exactly (maximum %d)",
+			t.NumPlayers, maxNumPlayers))
+	}
+
+	gs := GameState{
+		ScoreThisRound: t.ScoreThisRound,
+		NumDiceToRoll:  t.NumDiceToRoll,
+		NumPlayers:     t.NumPlayers,
+	}
+	copy(gs.PlayerScores[:], t.PlayerScores[:])
+	copy(gs.ConsecutiveFarkles[:], t.ConsecutiveFarkles[:])
+	return gs
+}
+
+// Scores are formatted in units of the score increment,
+// which depends on the rules. See Rules.FormatTable.
+func (t Table) String() string {
+	return t.format(func(score uint16) int { return int(score) })
+}
+
+func (t Table) format(points func(uint16) int) string {
+	n := t.NumPlayers
+	return formatState(points, t.ScoreThisRound, t.NumDiceToRoll,
+		t.PlayerScores[:n], t.ConsecutiveFarkles[:n])
+}
+
+// Whether the game is over. See GameState.IsGameOver.
+func (t Table) IsGameOver(rules *Rules) bool {
+	return t.CurrentPlayerScore() >= rules.scoreToWin()
+}
+
+// Score of the current player.
+func (t Table) CurrentPlayerScore() uint16 {
+	return t.PlayerScores[0]
+}
+
+// Highest score of any player.
+func (t Table) HighestScore() uint16 {
+	return highestScore(t.PlayerScores[:t.NumPlayers])
+}
+
+// Whether the current player may stop after holding the given dice.
+// See Rules.CanStop.
+func (t Table) CanStop(rules *Rules, heldDiceID uint16) bool {
+	return rules.canStop(t.CurrentPlayerScore(), t.ScoreThisRound, heldDiceID)
+}
+
+// Like ApplyAction, for a table.
+func ApplyTableAction(rules *Rules, t Table, action Action) Table {
+	if rollNumDice[action.HeldDiceID] > t.NumDiceToRoll {
+		panic(illegalActionError(action, rules.FormatTable(t), t.NumDiceToRoll))
+	}
+	n := t.NumPlayers
+	applyAction(rules, &t.ScoreThisRound, &t.NumDiceToRoll,
+		t.PlayerScores[:n], t.ConsecutiveFarkles[:n], action)
+	return t
+}
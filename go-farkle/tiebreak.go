@@ -0,0 +1,182 @@
+package farkle
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// TieBreak is how a game that ends with several players tied for the
+// highest score is valued.
+type TieBreak int
+
+const (
+	// The win is split evenly among the tied players.
+	SplitTies TieBreak = iota
+	// Every tied player loses.
+	TiesLose
+	// Every tied player wins.
+	TiesWin
+	// The tied players play one more round in turn order, starting with
+	// the next player to play, and whoever banks the most points in a
+	// single turn wins. The round is repeated if they tie again.
+	SuddenDeath
+	numTieBreaks
+)
+
+var tieBreakNames = [numTieBreaks]string{
+	SplitTies:   "split",
+	TiesLose:    "loss",
+	TiesWin:     "win",
+	SuddenDeath: "sudden_death",
+}
+
+func (t TieBreak) String() string {
+	if t < 0 || t >= numTieBreaks {
+		return fmt.Sprintf("TieBreak(%d)", int(t))
+	}
+	return tieBreakNames[t]
+}
+
+// Parse the name of a tie-breaking policy, as returned by String.
+func ParseTieBreak(name string) (TieBreak, error) {
+	for t, tName := range tieBreakNames {
+		if name == tName {
+			return TieBreak(t), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown tie-break policy %q, valid options: %s",
+		name, strings.Join(tieBreakNames[:], ", "))
+}
+
+// Whether the win probabilities of all players always sum to 1,
+// which quantized databases rely on.
+func (t TieBreak) conservesWins() bool {
+	return t == SplitTies || t == SuddenDeath
+}
+
+// Expected value of a k-way tie for the highest score to one of the
+// tied players, not knowing their order in a sudden-death round.
+func (rules *Rules) tieValue(k int) float64 {
+	switch rules.TieBreak {
+	case TiesLose:
+		return 0
+	case TiesWin:
+		return 1
+	default:
+		// A sudden-death round is won by exactly one player.
+		return 1 / float64(k)
+	}
+}
+
+// Win probabilities in a state where the game is over.
+func calcEndGameValue(rules *Rules, state GameState) [maxNumPlayers]float64 {
+	var result [maxNumPlayers]float64
+	endGameValue(rules, state.PlayerScores[:state.NumPlayers], result[:])
+	return result
+}
+
+// Like calcEndGameValue, for a table.
+func calcTableEndGameValue(rules *Rules, t Table) [MaxNumPlayers]float64 {
+	var result [MaxNumPlayers]float64
+	endGameValue(rules, t.PlayerScores[:t.NumPlayers], result[:])
+	return result
+}
+
+// Set the win probability of each player given their final scores.
+func endGameValue(rules *Rules, scores []uint16, result []float64) {
+	winningScore := highestScore(scores)
+	winners := make([]int, 0, MaxNumPlayers)
+	for player, score := range scores {
+		if score == winningScore {
+			winners = append(winners, player)
+		}
+	}
+
+	k := len(winners)
+	if k == 1 {
+		result[winners[0]] = 1
+		return
+	}
+
+	switch rules.TieBreak {
+	case TiesLose:
+	case TiesWin:
+		for _, winner := range winners {
+			result[winner] = 1
+		}
+	case SuddenDeath:
+		// The current player is next to play, so the tied
+		// players play the extra round in order of their index.
+		// Only the first player's probability is solved for: as an
+		// approximation, the others split the rest evenly, although
+		// playing later in the round is an advantage.
+		pFirst := suddenDeathWinProbs(rules)[k]
+		result[winners[0]] = pFirst
+		for _, winner := range winners[1:] {
+			result[winner] = (1 - pFirst) / float64(k-1)
+		}
+	default:
+		for _, winner := range winners {
+			result[winner] = 1 / float64(k)
+		}
+	}
+}
+
+type suddenDeathKey struct {
+	scoring   *ScoringRules
+	incr      int
+	numScores int
+}
+
+// Cached results of solveSuddenDeath, by suddenDeathKey.
+var suddenDeathCache sync.Map
+
+// Probability that the first player in a sudden-death round wins,
+// indexed by the number of tied players.
+func suddenDeathWinProbs(rules *Rules) *[MaxNumPlayers + 1]float64 {
+	key := suddenDeathKey{rules.Scoring, rules.scoreIncrement(), rules.numScores()}
+	if probs, ok := suddenDeathCache.Load(key); ok {
+		return probs.(*[MaxNumPlayers + 1]float64)
+	}
+	probs, _ := suddenDeathCache.LoadOrStore(key, solveSuddenDeath(rules))
+	return probs.(*[MaxNumPlayers + 1]float64)
+}
+
+// Solve the sudden-death round for every number of tied players. The first
+// player sets a score that each of the others then tries to beat, playing
+// to maximize the probability of reaching it. Scores this round are capped
+// at the highest score of the rules, and the farkle penalty is ignored.
+func solveSuddenDeath(rules *Rules) *[MaxNumPlayers + 1]float64 {
+	rolls := newTurnRolls(rules)
+	pReach := rolls.reachProbs(rules.numScores())
+
+	var result [MaxNumPlayers + 1]float64
+	for k := 2; k <= MaxNumPlayers; k++ {
+		others := float64(k - 1)
+		stopValues := make([]float64, rules.numScores())
+		stopValues[0] = math.NaN() // Every hold scores.
+		for score := 1; score < len(stopValues); score++ {
+			stopValues[score] = math.Pow(1-pReach[score+1], others)
+		}
+
+		// If the first player farkles and so does everyone else, the
+		// round is repeated, so its value W satisfies W = value(c*W),
+		// which is solved with Newton's method.
+		c := math.Pow(1-pReach[1], others)
+		w := 1 / float64(k)
+		for i := 0; i < 100; i++ {
+			values, pFarkle := rolls.solveTurn(stopValues, c*w, false)
+			g := values[0][MaxNumDice] - w
+			next := w - g/(c*pFarkle[0][MaxNumDice]-1)
+			if math.Abs(next-w) < 1e-12 {
+				break
+			}
+			w = next
+		}
+		result[k] = w
+	}
+
+	return &result
+}
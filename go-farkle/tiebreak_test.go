@@ -0,0 +1,46 @@
+package farkle
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEndGameValue(t *testing.T) {
+	rulesWith := func(tieBreak TieBreak) *Rules {
+		return &Rules{Scoring: StandardScoring, ScoreToWin: 10000, TieBreak: tieBreak}
+	}
+	pFirst := suddenDeathWinProbs(rulesWith(SuddenDeath))
+	if p := pFirst[2]; p <= 0 || p >= 1 {
+		t.Fatalf("first player wins a 2-way sudden-death round with probability %v", p)
+	}
+
+	testCases := []struct {
+		name     string
+		tieBreak TieBreak
+		scores   []uint16
+		want     []float64
+	}{
+		{"one winner", SplitTies, []uint16{200, 210, 205}, []float64{0, 1, 0}},
+		{"one winner, ties lose", TiesLose, []uint16{200, 210, 205}, []float64{0, 1, 0}},
+		{"split", SplitTies, []uint16{210, 200, 210}, []float64{0.5, 0, 0.5}},
+		{"split 3 ways", SplitTies, []uint16{210, 210, 210}, []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}},
+		{"ties lose", TiesLose, []uint16{210, 200, 210}, []float64{0, 0, 0}},
+		{"ties win", TiesWin, []uint16{210, 200, 210}, []float64{1, 0, 1}},
+		{"sudden death", SuddenDeath, []uint16{210, 200, 210},
+			[]float64{pFirst[2], 0, 1 - pFirst[2]}},
+		{"sudden death 3 ways", SuddenDeath, []uint16{200, 210, 210, 210},
+			[]float64{0, pFirst[3], (1 - pFirst[3]) / 2, (1 - pFirst[3]) / 2}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := make([]float64, len(tc.scores))
+			endGameValue(rulesWith(tc.tieBreak), tc.scores, got)
+			for i := range got {
+				if math.Abs(got[i]-tc.want[i]) > 1e-12 {
+					t.Fatalf("got %v, expected %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package farkle
+
+// TurnOutcome is the probability of banking a number of points.
+type TurnOutcome struct {
+	Points int
+	Prob   float64
+}
+
+// TurnDistribution is the probability distribution of the points banked
+// at the end of a turn.
+type TurnDistribution struct {
+	// Probability of farkling, which banks nothing (before any farkle penalty).
+	PFarkle float64
+	// Probability of banking each number of points without
+	// farkling, sorted by points.
+	Outcomes []TurnOutcome
+}
+
+// Probability of banking at least the given number of points.
+// A farkle counts as banking 0 points.
+func (d *TurnDistribution) PAtLeast(points int) float64 {
+	p := 0.0
+	if points <= 0 {
+		p += d.PFarkle
+	}
+	for _, o := range d.Outcomes {
+		if o.Points >= points {
+			p += o.Prob
+		}
+	}
+	return p
+}
+
+// Expected points banked, counting a farkle as 0.
+func (d *TurnDistribution) ExpectedPoints() float64 {
+	mean := 0.0
+	for _, o := range d.Outcomes {
+		mean += o.Prob * float64(o.Points)
+	}
+	return mean
+}
+
+// Distribution of the final score this round, indexed by score.
+type turnDist struct {
+	pFarkle float64
+	banked  []float64
+}
+
+// Calculate the distribution of the points banked at the end of the
+// current turn if the player plays the rest of it with the given strategy,
+// before rolling at the given table. Points banked include the score this
+// round so far. As in the solver, continuing to roll once the score this
+// round has overflowed is treated as banking.
+func CalcTurnDistribution(rules *Rules, table Table, strategy Strategy) TurnDistribution {
+	memo := make(map[[2]uint16]*turnDist)
+	var calc func(table Table) *turnDist
+	calc = func(table Table) *turnDist {
+		// The strategy may depend on the whole table, but within
+		// a turn only the score this round and dice to roll change.
+		key := [2]uint16{table.ScoreThisRound, uint16(table.NumDiceToRoll)}
+		if d, ok := memo[key]; ok {
+			return d
+		}
+
+		d := &turnDist{banked: make([]float64, rules.numScores())}
+		for _, wRoll := range allRolls[table.NumDiceToRoll] {
+			if IsFarkle(rules.Scoring, wRoll.Roll) {
+				d.pFarkle += wRoll.Prob
+				continue
+			}
+
+			action := strategy.ChooseAction(table, wRoll.Roll)
+			checkLegalAction(rules, table, wRoll.Roll, action)
+			newTable := ApplyTableAction(rules, table, Action{HeldDiceID: action.HeldDiceID, ContinueRolling: true})
+			if !action.ContinueRolling || newTable.ScoreThisRound == rules.maxScore() {
+				d.banked[newTable.ScoreThisRound] += wRoll.Prob
+				continue
+			}
+
+			sub := calc(newTable)
+			d.pFarkle += wRoll.Prob * sub.pFarkle
+			for score, p := range sub.banked {
+				d.banked[score] += wRoll.Prob * p
+			}
+		}
+
+		memo[key] = d
+		return d
+	}
+
+	d := calc(table)
+	result := TurnDistribution{PFarkle: d.pFarkle}
+	for score, p := range d.banked {
+		if p > 0 {
+			result.Outcomes = append(result.Outcomes, TurnOutcome{Points: rules.Points(uint16(score)), Prob: p})
+		}
+	}
+	return result
+}